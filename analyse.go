@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"group-wrapped/pkg"
+)
+
+// analyseOptions are the per-request settings of an analysis.
+type analyseOptions struct {
+	redactor  *pkg.Redactor
+	dateRange pkg.DateRange
+	parse     pkg.ParseOptions
+}
+
+// analyse runs the whole pipeline on an uploaded export. exp.Ext picks the
+// parser: ".json" is a Telegram export, anything else is WhatsApp text.
+// Messages are redacted before they reach DuckDB, so nothing derived from
+// them can leak what the redactor masks. Only messages within the date
+// range are analysed.
+func analyse(exp pkg.Export, opts analyseOptions) (Output, error) {
+	messages, err := pkg.ParseExport(exp, opts.parse)
+	if err != nil {
+		return Output{}, err
+	}
+
+	redactions := opts.redactor.RedactMessages(messages)
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return Output{}, fmt.Errorf("failed to connect to duckdb: %w", err)
+	}
+	defer db.Close()
+
+	if err := pkg.PrepDBRange(db, messages, opts.dateRange); err != nil {
+		return Output{}, err
+	}
+
+	stats := pkg.GetStats(db)
+	stats.Attachments.Partial = exp.AttachmentsPartial
+	comparison, err := pkg.GetComparison(db, stats, opts.dateRange)
+	if err != nil {
+		return Output{}, err
+	}
+	cards := pkg.AssignCards(db, stats)
+
+	return Output{
+		Statistics: stats,
+		Cards:      cards,
+		Comparison: comparison,
+		Redactions: redactions,
+		Timezone:   opts.parse.Location.String(),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"group-wrapped/pkg"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ChatArchive keeps the raw chats of users who consented to it. Chats live
+// under "uploads/" as "<id>.txt", next to an "<id>.owner" object holding the
+// hash of the upload's delete token. With a key ring, chats are stored as
+// encrypted envelopes instead of plain text.
+type ChatArchive struct {
+	storage pkg.Storage
+	ttl     time.Duration
+	keys    *pkg.KeyRing
+	// legacySwept is set once no chat is left at the bucket root, so Sweep
+	// stops listing the whole bucket
+	legacySwept atomic.Bool
+}
+
+// NewChatArchive returns an archive that encrypts chats with keys, or
+// stores them in plain text if keys is nil.
+func NewChatArchive(storage pkg.Storage, ttl time.Duration, keys *pkg.KeyRing) *ChatArchive {
+	return &ChatArchive{storage: storage, ttl: ttl, keys: keys}
+}
+
+// Save archives the raw chat under id. The owner object goes first, so there
+// is never a chat its uploader can't delete.
+func (a *ChatArchive) Save(ctx context.Context, id string, txt []byte, token string) error {
+	prefix := pkg.ArchivePrefixes[0]
+
+	meta := pkg.ObjectMeta{ContentType: "text/plain"}
+	if err := a.storage.Put(ctx, pkg.ArchiveOwnerKey(prefix, id), []byte(hashToken(token)), meta); err != nil {
+		return err
+	}
+
+	err := a.saveChat(ctx, pkg.ArchiveChatKey(prefix, id), txt)
+	if err != nil {
+		if err := a.storage.Delete(ctx, pkg.ArchiveOwnerKey(prefix, id)); err != nil {
+			log.Println(err)
+		}
+	}
+	return err
+}
+
+func (a *ChatArchive) saveChat(ctx context.Context, key string, txt []byte) error {
+	meta := pkg.ObjectMeta{ContentType: "text/plain"}
+	if a.keys != nil {
+		sealed, err := a.keys.Seal(txt)
+		if err != nil {
+			return err
+		}
+
+		txt = sealed
+		meta = pkg.ObjectMeta{
+			ContentType: "application/octet-stream",
+			Metadata:    map[string]string{pkg.MetaKeyID: a.keys.CurrentKeyID()},
+		}
+	}
+
+	return a.storage.Put(ctx, key, txt, meta)
+}
+
+// SaveIfConsented archives the redacted export if the uploader consented
+// to it, and reports whether it did.
+func (a *ChatArchive) SaveIfConsented(ctx context.Context, consent bool, id, txt string, redactor *pkg.Redactor, token string) bool {
+	if !consent {
+		return false
+	}
+
+	if err := a.Save(ctx, id, []byte(redactor.RedactExport(txt)), token); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// Delete erases the archived chat if token matches the one passed to Save.
+func (a *ChatArchive) Delete(ctx context.Context, id, token string) error {
+	for _, prefix := range pkg.ArchivePrefixes {
+		hash, err := a.storage.Get(ctx, pkg.ArchiveOwnerKey(prefix, id))
+		if errors.Is(err, pkg.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !tokenMatches(token, string(hash)) {
+			return ErrBadDeleteToken
+		}
+
+		if err := a.storage.Delete(ctx, pkg.ArchiveChatKey(prefix, id)); err != nil && !errors.Is(err, pkg.ErrNotFound) {
+			return err
+		}
+		return a.storage.Delete(ctx, pkg.ArchiveOwnerKey(prefix, id))
+	}
+	return pkg.ErrNotFound
+}
+
+// Sweep deletes every archived chat (and its owner object) older than the
+// retention TTL, including those still at the bucket root.
+func (a *ChatArchive) Sweep() {
+	ctx := context.Background()
+
+	for _, prefix := range pkg.ArchivePrefixes {
+		if prefix == "" && a.legacySwept.Load() {
+			continue
+		}
+
+		objects, err := a.storage.List(ctx, prefix)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		left := 0
+		for _, o := range objects {
+			name := strings.TrimPrefix(o.Key, prefix)
+			if strings.Contains(name, "/") || (!strings.HasSuffix(name, ".txt") && !strings.HasSuffix(name, ".owner")) {
+				continue
+			}
+			if time.Since(o.ModTime) <= a.ttl {
+				left++
+				continue
+			}
+
+			if err := a.storage.Delete(ctx, o.Key); err != nil && !errors.Is(err, pkg.ErrNotFound) {
+				log.Println(err)
+				left++
+			}
+		}
+
+		if prefix == "" && left == 0 {
+			a.legacySwept.Store(true)
+		}
+	}
+}
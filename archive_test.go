@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"group-wrapped/pkg"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeyRing(t *testing.T) *pkg.KeyRing {
+	t.Helper()
+
+	keys, err := pkg.NewKeyRing([]string{"k1"}, [][]byte{bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestArchiveConsent(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	archive := NewChatArchive(storage, time.Hour, nil)
+	redactor := pkg.NewRedactor(pkg.AllRedactCategories)
+	chat := "22/05/2025, 18:01 - Mila: mail me at mila@example.com"
+
+	if archive.SaveIfConsented(ctx, false, "declined", chat, redactor, "token") {
+		t.Error("archived a chat without consent")
+	}
+	if objects, _ := storage.List(ctx, ""); len(objects) != 0 {
+		t.Errorf("storage holds %d objects after an upload without consent", len(objects))
+	}
+
+	if !archive.SaveIfConsented(ctx, true, "agreed", chat, redactor, "token") {
+		t.Fatal("did not archive a chat with consent")
+	}
+	got, err := pkg.ReadArchive(ctx, storage, "agreed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "22/05/2025, 18:01 - Mila: mail me at [email]"; string(got) != want {
+		t.Errorf("archived %q, want the redacted %q", got, want)
+	}
+}
+
+// TestArchiveUnseal opens an archive the way cmd/unseal does.
+func TestArchiveUnseal(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	keys := testKeyRing(t)
+	chat := []byte("22/05/2025, 18:01 - Mila: hi")
+
+	if err := NewChatArchive(storage, time.Hour, keys).Save(ctx, "abc", chat, "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := storage.Get(ctx, pkg.ArchiveChatKey(pkg.ArchivePrefixes[0], "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkg.IsEnvelope(stored) {
+		t.Error("the chat is stored in plain text despite the key ring")
+	}
+
+	got, err := pkg.ReadArchive(ctx, storage, "abc", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, chat) {
+		t.Errorf("ReadArchive = %q, want %q", got, chat)
+	}
+
+	if _, err := pkg.ReadArchive(ctx, storage, "missing", keys); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("ReadArchive of a missing chat returned %v, want ErrNotFound", err)
+	}
+}
+
+// failingStorage fails every Put of a key with the given suffix.
+type failingStorage struct {
+	pkg.Storage
+	suffix string
+}
+
+func (f failingStorage) Put(ctx context.Context, key string, data []byte, meta pkg.ObjectMeta) error {
+	if strings.HasSuffix(key, f.suffix) {
+		return errors.New("disk full")
+	}
+	return f.Storage.Put(ctx, key, data, meta)
+}
+
+func TestArchiveSaveFailureLeavesNothing(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	archive := NewChatArchive(failingStorage{storage, ".txt"}, time.Hour, nil)
+
+	if err := archive.Save(ctx, "abc", []byte("chat"), "token"); err == nil {
+		t.Fatal("Save succeeded without storing the chat")
+	}
+	if objects, _ := storage.List(ctx, ""); len(objects) != 0 {
+		t.Errorf("a failed Save left %d objects behind", len(objects))
+	}
+}
+
+func TestArchiveDelete(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	archive := NewChatArchive(storage, time.Hour, nil)
+
+	if err := archive.Save(ctx, "abc", []byte("chat"), "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Delete(ctx, "abc", "wrong"); !errors.Is(err, ErrBadDeleteToken) {
+		t.Errorf("Delete with a wrong token returned %v, want ErrBadDeleteToken", err)
+	}
+	if _, err := pkg.ReadArchive(ctx, storage, "abc", nil); err != nil {
+		t.Errorf("the chat is gone after a rejected Delete: %v", err)
+	}
+
+	if err := archive.Delete(ctx, "abc", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ := storage.List(ctx, ""); len(objects) != 0 {
+		t.Errorf("Delete left %d objects behind", len(objects))
+	}
+	if err := archive.Delete(ctx, "abc", "token"); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("second Delete returned %v, want ErrNotFound", err)
+	}
+
+	// chats archived before the uploads/ prefix can still be deleted
+	legacy := pkg.ArchivePrefixes[len(pkg.ArchivePrefixes)-1]
+	if err := storage.Put(ctx, pkg.ArchiveChatKey(legacy, "old"), []byte("chat"), pkg.ObjectMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, pkg.ArchiveOwnerKey(legacy, "old"), []byte(hashToken("token")), pkg.ObjectMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Delete(ctx, "old", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ := storage.List(ctx, ""); len(objects) != 0 {
+		t.Errorf("Delete of a legacy chat left %d objects behind", len(objects))
+	}
+}
+
+func TestArchiveSweep(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	for _, key := range []string{"uploads/a.txt", "uploads/a.owner", "b.txt", "b.owner", "results/c.json"} {
+		if err := storage.Put(ctx, key, []byte("data"), pkg.ObjectMeta{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing is old enough yet
+	NewChatArchive(storage, time.Hour, nil).Sweep()
+	if objects, _ := storage.List(ctx, ""); len(objects) != 5 {
+		t.Errorf("Sweep deleted fresh objects, %d left", len(objects))
+	}
+
+	NewChatArchive(storage, -time.Second, nil).Sweep()
+	objects, err := storage.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "results/c.json" {
+		t.Errorf("Sweep left %v, want only results/c.json", objects)
+	}
+}
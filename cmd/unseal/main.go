@@ -0,0 +1,44 @@
+// Command unseal prints an archived chat in plain text, decrypting it with
+// ARCHIVE_MASTER_KEYS if needed. Storage is configured through the same
+// environment as the server.
+//
+//	go run ./cmd/unseal <upload id> > chat.txt
+package main
+
+import (
+	"context"
+	"group-wrapped/pkg"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: unseal <upload id>")
+	}
+
+	// .env is optional here, the environment may already be set up
+	_ = godotenv.Load()
+
+	ctx := context.Background()
+	storage, err := pkg.NewStorageFromEnv(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := pkg.NewKeyRingFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	txt, err := pkg.ReadArchive(ctx, storage, os.Args[1], keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := os.Stdout.Write(txt); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,351 @@
+// Command wrapped analyses a chat export offline and prints the result.
+//
+//	go run ./cmd/wrapped [-format json|table|md] [-seed N] [-tz Zone] [-date-order dmy|mdy] [-year YYYY | -from YYYY-MM-DD -to YYYY-MM-DD] <export.txt|.zip|.json>
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"group-wrapped/pkg"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+// Output is the JSON the server answers with, minus the share link,
+// redaction counts and time zone, which only the server deals with.
+type Output struct {
+	Statistics pkg.Stats       `json:"statistics"`
+	Cards      []pkg.Card      `json:"cards"`
+	Comparison *pkg.Comparison `json:"comparison,omitempty"`
+}
+
+// exports read from disk are trusted, this only guards against reading a
+// wrong multi-gigabyte file into memory
+var limits = pkg.ExportLimits{Chat: 1 << 30, Media: 1 << 40, Files: 1 << 20}
+
+func main() {
+	format := flag.String("format", "json", "output format: json, table or md")
+	seed := flag.Int64("seed", 0, "seed for the card draw; 0 picks a random one")
+	year := flag.String("year", "", "only analyse messages sent in this year")
+	from := flag.String("from", "", "only analyse messages sent on or after this date (YYYY-MM-DD)")
+	to := flag.String("to", "", "only analyse messages sent on or before this date (YYYY-MM-DD)")
+	tz := flag.String("tz", "UTC", "IANA time zone the export was written in")
+	dateOrder := flag.String("date-order", "", "dmy or mdy for exports whose dates could be read either way")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: wrapped [flags] <export.txt|export.zip|result.json>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dateRange, err := pkg.ParseDateRange(*year, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	location, err := pkg.ResolveLocation(*tz, "", "")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	order, err := pkg.ParseDateOrder(*dateOrder)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	path := flag.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exp, err := pkg.ReadExport(path, data, limits)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	messages, err := pkg.ParseExport(exp, pkg.ParseOptions{Location: location, DateOrder: order})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := pkg.PrepDBRange(db, messages, dateRange); err != nil {
+		log.Fatal(err)
+	}
+
+	if *seed == 0 {
+		*seed = rand.Int63()
+	}
+
+	stats := pkg.GetStats(db)
+	stats.Attachments.Partial = exp.AttachmentsPartial
+	comparison, err := pkg.GetComparison(db, stats, dateRange)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := Output{
+		Statistics: stats,
+		Cards:      pkg.AssignCardsRand(db, stats, rand.New(rand.NewSource(*seed))),
+		Comparison: comparison,
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(out)
+	case "table":
+		err = printTable(os.Stdout, out)
+	case "md":
+		err = printMarkdown(os.Stdout, out)
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// section is one titled two-column block of the report.
+type section struct {
+	title   string
+	columns [2]string
+	rows    [][2]string
+}
+
+func sections(out Output) []section {
+	s := out.Statistics
+
+	summary := section{"Summary", [2]string{"", ""}, [][2]string{
+		{"Messages", fmt.Sprint(s.TotalMessages)},
+		{"Conversations", fmt.Sprint(s.TotalConversations)},
+		{"Covered", s.FirstMessage.Format("2006-01-02") + " to " + s.LastMessage.Format("2006-01-02")},
+		{"Couple", fmt.Sprintf("%s & %s (%d)", s.Duo.PersonOne, s.Duo.PersonTwo, s.Duo.Count)},
+		{"Busiest day", fmt.Sprintf("%s (%d)", s.BusiestDay.Date, s.BusiestDay.Count)},
+		{"Active days", fmt.Sprint(s.Activity.ActiveDays)},
+		{"Longest streak", fmt.Sprintf("%d days (%s to %s)", s.Activity.LongestStreak.Days, s.Activity.LongestStreak.Start, s.Activity.LongestStreak.End)},
+	}}
+
+	perPerson := section{"Messages per person", [2]string{"Sender", "Messages"}, nil}
+	for _, m := range s.MessagesPerPerson {
+		perPerson.rows = append(perPerson.rows, [2]string{m.Sender, fmt.Sprint(m.Count)})
+	}
+
+	emojis := section{"Top emojis", [2]string{"Emoji", "Count"}, nil}
+	for _, e := range s.Top3Emojis {
+		emojis.rows = append(emojis.rows, [2]string{e.Emoji, fmt.Sprint(e.Count)})
+	}
+
+	perMonth := section{"Messages per month", [2]string{"Month", "Messages"}, nil}
+	for _, m := range s.MessagesPerMonth {
+		perMonth.rows = append(perMonth.rows, [2]string{m.Date, fmt.Sprint(m.Count)})
+	}
+
+	ret := []section{summary, perPerson, perMonth, emojis}
+	for _, media := range []struct {
+		title  string
+		counts []pkg.MediaCount
+	}{
+		{"Images", s.ImagesPerPerson},
+		{"Videos", s.VideosPerPerson},
+		{"Audio", s.AudioPerPerson},
+		{"Stickers", s.StickersPerPerson},
+		{"All media", s.MediaPerPerson},
+	} {
+		if len(media.counts) == 0 {
+			continue
+		}
+
+		sec := section{media.title, [2]string{"Sender", "Count"}, nil}
+		for _, m := range media.counts {
+			sec.rows = append(sec.rows, [2]string{m.Sender, fmt.Sprint(m.Count)})
+		}
+		ret = append(ret, sec)
+	}
+
+	if a := s.Attachments; a.Largest != nil {
+		title := "Media volume"
+		if a.Partial {
+			title += " (partial, media limit reached)"
+		}
+		sec := section{title, [2]string{"Sender", "Files (MB)"}, nil}
+		for _, v := range a.VolumePerPerson {
+			sec.rows = append(sec.rows, [2]string{v.Sender, fmt.Sprintf("%d (%.2f)", v.Files, v.MB)})
+		}
+		for _, t := range a.FileTypes {
+			sec.rows = append(sec.rows, [2]string{t.Type, fmt.Sprintf("%d (%.2f)", t.Files, t.MB)})
+		}
+		sec.rows = append(sec.rows, [2]string{"Largest", fmt.Sprintf("%s by %s (%.2f MB)", a.Largest.Name, a.Largest.Sender, a.Largest.MB)})
+		ret = append(ret, sec)
+	}
+
+	heatmap := section{"Busiest hours", [2]string{"Weekday", "Messages (busiest hour)"}, nil}
+	for day, hours := range s.Heatmap {
+		total, busiest := 0, 0
+		for hour, count := range hours {
+			total += count
+			if count > hours[busiest] {
+				busiest = hour
+			}
+		}
+		// rows start on Monday, time.Weekday on Sunday
+		row := [2]string{time.Weekday((day + 1) % 7).String(), "0"}
+		if total > 0 {
+			row[1] = fmt.Sprintf("%d (%02d:00, %d)", total, busiest, hours[busiest])
+		}
+		heatmap.rows = append(heatmap.rows, row)
+	}
+	ret = append(ret, heatmap)
+
+	if len(s.ReplyTimes) > 0 {
+		sec := section{"Reply times", [2]string{"Sender", "Median / p90 in conversation (overall)"}, nil}
+		for _, r := range s.ReplyTimes {
+			sec.rows = append(sec.rows, [2]string{r.Sender, fmt.Sprintf("%s / %s over %d replies (%s / %s over %d)",
+				seconds(r.MedianSeconds), seconds(r.P90Seconds), r.Replies,
+				seconds(r.OverallMedianSeconds), seconds(r.OverallP90Seconds), r.OverallReplies)})
+		}
+		ret = append(ret, sec)
+	}
+
+	if len(s.MostIgnored) > 0 {
+		sec := section{"Most ignored", [2]string{"Sender", "Ignored of started"}, nil}
+		for _, i := range s.MostIgnored {
+			sec.rows = append(sec.rows, [2]string{i.Sender, fmt.Sprintf("%d of %d (%d%%)", i.Ignored, i.Started, i.Percent)})
+		}
+		ret = append(ret, sec)
+	}
+
+	if len(s.Streaks) > 0 {
+		sec := section{"Streaks", [2]string{"Sender", "Longest (bursts, double texts, average)"}, nil}
+		for _, st := range s.Streaks {
+			sec.rows = append(sec.rows, [2]string{st.Sender, fmt.Sprintf("%d (%d, %d, %.1f)", st.Longest, st.Bursts, st.DoubleTexts, st.AverageBurst)})
+		}
+		ret = append(ret, sec)
+	}
+
+	if g := s.Graph; len(g.Edges) > 0 {
+		sec := section{"Who answers whom", [2]string{"", "Replies"}, nil}
+		for _, e := range g.Edges {
+			sec.rows = append(sec.rows, [2]string{e.From + " -> " + e.To, fmt.Sprint(e.Weight)})
+		}
+		if p := g.MostReciprocal; p != nil {
+			sec.rows = append(sec.rows, [2]string{"Most reciprocal", fmt.Sprintf("%s & %s (%d / %d)", p.PersonOne, p.PersonTwo, p.OneToTwo, p.TwoToOne)})
+		}
+		for _, p := range g.OneSided {
+			sec.rows = append(sec.rows, [2]string{"One-sided", fmt.Sprintf("%s -> %s (%d / %d)", p.PersonOne, p.PersonTwo, p.OneToTwo, p.TwoToOne)})
+		}
+		sec.rows = append(sec.rows, [2]string{"Most central", g.MostCentral})
+		ret = append(ret, sec)
+	}
+
+	if m := s.Membership; len(m.Events) > 0 {
+		sec := section{"Membership", [2]string{"When", "What"}, nil}
+		for _, e := range m.Events {
+			what := e.Actor + " " + e.Action
+			switch {
+			case e.Action == pkg.ActionIcon:
+				what = e.Actor + " changed the icon"
+			case e.Action == pkg.ActionCreated || e.Action == pkg.ActionRenamed:
+				what += fmt.Sprintf(" %q", e.Subject)
+			case e.Subject != e.Actor:
+				what += " " + e.Subject
+			}
+			sec.rows = append(sec.rows, [2]string{e.Timestamp.Format("2006-01-02 15:04"), what})
+		}
+		sec.rows = append(sec.rows, [2]string{"Members", strings.Join(m.CurrentMembers, ", ")})
+		if len(m.FormerMembers) > 0 {
+			sec.rows = append(sec.rows, [2]string{"Former members", strings.Join(m.FormerMembers, ", ")})
+		}
+		ret = append(ret, sec)
+	}
+
+	cards := section{"Cards", [2]string{"Card", "Person (value)"}, nil}
+	for _, c := range out.Cards {
+		cards.rows = append(cards.rows, [2]string{c.Type, fmt.Sprintf("%s (%d)", c.Person, c.Value)})
+	}
+	ret = append(ret, cards)
+
+	if c := out.Comparison; c != nil {
+		title := fmt.Sprintf("Compared to %s to %s", c.PreviousFirstMessage.Format("2006-01-02"), c.PreviousLastMessage.Format("2006-01-02"))
+		sec := section{title, [2]string{"", "Previous -> now"}, [][2]string{
+			{"Messages", formatDelta(c.TotalMessages)},
+			{"Conversations", formatDelta(c.TotalConversations)},
+		}}
+		for _, p := range c.People {
+			sec.rows = append(sec.rows, [2]string{p.Sender, formatDelta(p.Messages)})
+		}
+		for _, e := range c.Emojis {
+			sec.rows = append(sec.rows, [2]string{e.Emoji, formatDelta(e.Count)})
+		}
+		sec.rows = append(sec.rows,
+			[2]string{"Couple", fmt.Sprintf("%s & %s -> %s & %s", c.Couple.Previous.PersonOne, c.Couple.Previous.PersonTwo, c.Couple.Current.PersonOne, c.Couple.Current.PersonTwo)},
+			[2]string{"New", strings.Join(c.NewMembers, ", ")},
+			[2]string{"Departed", strings.Join(c.DepartedMembers, ", ")},
+		)
+		ret = append(ret, sec)
+	}
+	return ret
+}
+
+// seconds formats a duration given in seconds, like 1m30s.
+func seconds(n int) string {
+	return (time.Duration(n) * time.Second).String()
+}
+
+func formatDelta(d pkg.Delta) string {
+	if d.Percent == nil {
+		return fmt.Sprintf("%d -> %d", d.Previous, d.Current)
+	}
+	return fmt.Sprintf("%d -> %d (%+.1f%%)", d.Previous, d.Current, *d.Percent)
+}
+
+func printTable(w io.Writer, out Output) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, sec := range sections(out) {
+		fmt.Fprintf(tw, "%s\n%s\n", strings.ToUpper(sec.title), strings.Repeat("=", len(sec.title)))
+		if sec.columns != [2]string{} {
+			fmt.Fprintf(tw, "%s\t%s\n", sec.columns[0], sec.columns[1])
+		}
+		for _, r := range sec.rows {
+			fmt.Fprintf(tw, "%s\t%s\n", r[0], r[1])
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func printMarkdown(w io.Writer, out Output) error {
+	for _, sec := range sections(out) {
+		if _, err := fmt.Fprintf(w, "## %s\n\n| %s | %s |\n|---|---|\n", sec.title, sec.columns[0], sec.columns[1]); err != nil {
+			return err
+		}
+		for _, r := range sec.rows {
+			fmt.Fprintf(w, "| %s | %s |\n", mdEscape(r[0]), mdEscape(r[1]))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
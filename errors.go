@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"group-wrapped/pkg"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stable error codes the frontend localizes. Never rename these.
+const (
+	ErrCodeUnknownFormat      = "UNKNOWN_FORMAT"
+	ErrCodeBadTimestamp       = "BAD_TIMESTAMP"
+	ErrCodeEmptyChat          = "EMPTY_CHAT"
+	ErrCodeAmbiguousDateOrder = "AMBIGUOUS_DATE_ORDER"
+	ErrCodeBusy               = "BUSY"
+	ErrCodeNotFound           = "NOT_FOUND"
+	ErrCodeForbidden          = "FORBIDDEN"
+	ErrCodeInternal           = "INTERNAL"
+)
+
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// parseErrorResponse maps errors from the parsers and PrepDB onto a status
+// and an ErrorResponse.
+func parseErrorResponse(err error) (int, ErrorResponse) {
+	var badTs pkg.ErrBadTimestamp
+
+	switch {
+	case errors.As(err, &badTs):
+		return http.StatusBadRequest, ErrorResponse{
+			ErrCodeBadTimestamp,
+			"Could not read the date of a message in your chat export.",
+			badTs.Line,
+		}
+	case errors.Is(err, pkg.ErrUnknownFormat):
+		return http.StatusBadRequest, ErrorResponse{
+			ErrCodeUnknownFormat,
+			"Please upload a WhatsApp chat export (.zip or .txt) or a Telegram result.json.",
+			0,
+		}
+	case errors.Is(err, pkg.ErrAmbiguousDateOrder):
+		return http.StatusUnprocessableEntity, ErrorResponse{
+			ErrCodeAmbiguousDateOrder,
+			"We can't tell whether the dates in your chat are day/month or month/day. Please pick one.",
+			0,
+		}
+	case errors.Is(err, pkg.ErrEmptyChat):
+		return http.StatusUnprocessableEntity, ErrorResponse{
+			ErrCodeEmptyChat,
+			"Your chat export does not contain any messages.",
+			0,
+		}
+	default:
+		log.Println(err)
+		return http.StatusInternalServerError, ErrorResponse{
+			ErrCodeInternal,
+			"Something went wrong while analysing your chat.",
+			0,
+		}
+	}
+}
+
+func abortWithParseError(c *gin.Context, err error) {
+	status, resp := parseErrorResponse(err)
+	c.JSON(status, resp)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// ErrQueueFull is returned by Submit when every worker is busy and the
+// backlog is full.
+var ErrQueueFull = errors.New("job queue is full")
+
+// Job is the pollable state of one analysis. Output is set once the job is
+// done, Error once it failed.
+type Job struct {
+	ID         string         `json:"id"`
+	Status     JobStatus      `json:"status"`
+	Output     *Output        `json:"output,omitempty"`
+	Error      *ErrorResponse `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+
+	err  error
+	done chan struct{}
+	run  func() (Output, error)
+}
+
+// JobQueue runs analyses on a fixed number of workers and keeps finished
+// jobs in memory until they are older than ttl.
+type JobQueue struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	work chan *Job
+	ttl  time.Duration
+}
+
+// NewJobQueue starts `workers` goroutines pulling from a backlog of at most
+// `backlog` queued jobs.
+func NewJobQueue(workers, backlog int, ttl time.Duration) *JobQueue {
+	q := &JobQueue{
+		jobs: make(map[string]*Job),
+		work: make(chan *Job, backlog),
+		ttl:  ttl,
+	}
+
+	for range workers {
+		go q.worker()
+	}
+
+	return q
+}
+
+// NewJobQueueFromEnv reads JOB_WORKERS, JOB_BACKLOG and JOB_TTL (a
+// time.ParseDuration string), falling back to 2 workers, 32 queued jobs
+// and one hour.
+func NewJobQueueFromEnv() (*JobQueue, error) {
+	workers, err := envInt("JOB_WORKERS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	backlog, err := envInt("JOB_BACKLOG", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := envDuration("JOB_TTL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJobQueue(workers, backlog, ttl), nil
+}
+
+// Submit queues run under id and returns a channel closed once the job has
+// finished. It never blocks: if the backlog is full it returns ErrQueueFull.
+func (q *JobQueue) Submit(id string, run func() (Output, error)) (<-chan struct{}, error) {
+	job := &Job{
+		ID:        id,
+		Status:    JobQueued,
+		CreatedAt: time.Now(),
+		done:      make(chan struct{}),
+		run:       run,
+	}
+
+	q.mu.Lock()
+	q.jobs[id] = job
+	q.mu.Unlock()
+
+	select {
+	case q.work <- job:
+		return job.done, nil
+	default:
+		q.mu.Lock()
+		delete(q.jobs, id)
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+}
+
+// Get returns a snapshot of the job.
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return Job{
+		ID:         job.ID,
+		Status:     job.Status,
+		Output:     job.Output,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+		err:        job.err,
+	}, true
+}
+
+// Sweep forgets finished jobs older than the TTL.
+func (q *JobQueue) Sweep() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > q.ttl {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *JobQueue) worker() {
+	for job := range q.work {
+		q.mu.Lock()
+		job.Status = JobRunning
+		q.mu.Unlock()
+
+		out, err := runJob(job)
+
+		q.mu.Lock()
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			_, resp := parseErrorResponse(err)
+			job.Status = JobFailed
+			job.Error = &resp
+			job.err = err
+		} else {
+			job.Status = JobDone
+			job.Output = &out
+		}
+		job.run = nil
+		q.mu.Unlock()
+
+		close(job.done)
+	}
+}
+
+// runJob turns a panic in the analysis into an error so that one bad chat
+// can't take a worker down with it.
+func runJob(job *Job) (out Output, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("job", job.ID, "panicked:", r)
+			err = fmt.Errorf("analysis panicked: %v", r)
+		}
+	}()
+
+	return job.run()
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", key, v)
+	}
+	return n, nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration like 30m, got %q: %w", key, v, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitStatus polls until the job reaches status, failing after a second.
+func waitStatus(t *testing.T, q *JobQueue, id string, status JobStatus) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := q.Get(id); ok && job.Status == status {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s never reached %s", id, status)
+	return Job{}
+}
+
+func TestSubmitBeyondCapacity(t *testing.T) {
+	q := NewJobQueue(1, 1, time.Hour)
+
+	release := make(chan struct{})
+	blocking := func() (Output, error) {
+		<-release
+		return Output{}, nil
+	}
+
+	running, err := q.Submit("running", blocking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, q, "running", JobRunning)
+
+	queued, err := q.Submit("queued", blocking)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.Submit("rejected", blocking); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Submit on a full queue returned %v, want ErrQueueFull", err)
+	}
+	if _, ok := q.Get("rejected"); ok {
+		t.Error("a rejected job can be polled")
+	}
+
+	close(release)
+	<-running
+	<-queued
+	waitStatus(t, q, "queued", JobDone)
+}
+
+func TestPanickingJobFails(t *testing.T) {
+	q := NewJobQueue(1, 1, time.Hour)
+
+	done, err := q.Submit("panics", func() (Output, error) {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	job, ok := q.Get("panics")
+	if !ok {
+		t.Fatal("job is gone")
+	}
+	if job.Status != JobFailed {
+		t.Errorf("status = %s, want %s", job.Status, JobFailed)
+	}
+	if job.Error == nil || job.Error.Code != ErrCodeInternal {
+		t.Errorf("error = %+v, want code %s", job.Error, ErrCodeInternal)
+	}
+
+	// the worker survived and still runs jobs
+	done, err = q.Submit("after", func() (Output, error) { return Output{}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	waitStatus(t, q, "after", JobDone)
+}
+
+func TestSweepForgetsFinishedJobs(t *testing.T) {
+	q := NewJobQueue(1, 1, time.Millisecond)
+
+	done, err := q.Submit("finished", func() (Output, error) { return Output{}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	waitStatus(t, q, "finished", JobDone)
+
+	release := make(chan struct{})
+	defer close(release)
+	if _, err := q.Submit("running", func() (Output, error) {
+		<-release
+		return Output{}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, q, "running", JobRunning)
+
+	time.Sleep(5 * time.Millisecond)
+	q.Sweep()
+
+	if _, ok := q.Get("finished"); ok {
+		t.Error("finished job older than the TTL was not swept")
+	}
+	if _, ok := q.Get("running"); !ok {
+		t.Error("running job was swept")
+	}
+}
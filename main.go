@@ -1,10 +1,9 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
-	"database/sql"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"group-wrapped/pkg"
 	"io"
@@ -28,11 +27,34 @@ import (
 type Output struct {
 	Statistics pkg.Stats  `json:"statistics"`
 	Cards      []pkg.Card `json:"cards"`
+	// Comparison is only set when a bounded date range was requested
+	Comparison *pkg.Comparison     `json:"comparison,omitempty"`
+	Share      *Share              `json:"share,omitempty"`
+	Redactions pkg.RedactionCounts `json:"redactions"`
+	// Timezone is the zone the timestamps were read in
+	Timezone string `json:"timezone"`
+}
+
+// Share is only handed to the uploader: the upload id plus the token that
+// lets them delete the result and the archived chat again. ExpiresAt is
+// only set if the result was saved and can be linked to.
+type Share struct {
+	ID          string     `json:"id"`
+	DeleteToken string     `json:"deleteToken"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Archived    bool       `json:"archived"`
 }
 
 const (
 	maxUpload       = 1 << 20 // 5 MB  compressed
 	maxUncompressed = 3 << 20 // 10 MB uncompressed
+
+	// zips exported with media are mostly photos and videos, which hardly
+	// compress, so their attachments get a few times the upload size.
+	// Whatever is past maxMedia is skipped and reported as partial.
+	maxZipUpload = 64 << 20
+	maxMedia     = 256 << 20
+	maxZipFiles  = 10000
 )
 
 var dataMu sync.Mutex
@@ -43,11 +65,50 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	jobs, err := NewJobQueueFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := pkg.NewStorageFromEnv(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	resultsTTL, err := envDuration("RESULTS_TTL", 30*24*time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+	results := NewResultStore(storage, resultsTTL)
+
+	chatsTTL, err := envDuration("CHATS_TTL", 90*24*time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys, err := pkg.NewKeyRingFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// storing chats in plain text has to be asked for, so a missing
+	// variable can't silently turn encryption off
+	if keys == nil {
+		if os.Getenv("ARCHIVE_PLAINTEXT") != "true" {
+			log.Fatal("ARCHIVE_MASTER_KEYS is not set; set ARCHIVE_PLAINTEXT=true to archive chats unencrypted")
+		}
+		log.Println("ARCHIVE_PLAINTEXT is set, archived chats are stored unencrypted")
+	}
+	archive := NewChatArchive(storage, chatsTTL, keys)
+
+	defaultRedact, err := pkg.ParseRedactCategories(os.Getenv("REDACT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://192.168.1.41:5173", "https://whatswrapped.me", "http://localhost:5173"},
 		AllowMethods:     []string{"GET", "OPTIONS", "POST", "PUT", "PATCH", "DELETE"},
-		AllowHeaders:     []string{"Origin"},
+		AllowHeaders:     []string{"Origin", "X-Delete-Token"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -77,91 +138,241 @@ func main() {
 		limited := http.MaxBytesReader(c.Writer, upFile, maxUpload)
 
 		ext := strings.ToLower(filepath.Ext(hdr.Filename))
-		var txt string
+		var exp pkg.Export
 
 		switch ext {
 
-		case ".txt":
+		case ".txt", ".json":
 			body, err := io.ReadAll(&io.LimitedReader{R: limited, N: maxUncompressed})
 			if err != nil {
 				c.JSON(http.StatusBadRequest, "Unable to read the file.")
 				return
 			}
-			txt = string(body)
+			exp = pkg.Export{Ext: ext, Text: string(body)}
 
 		case ".zip":
-			zipBytes, err := io.ReadAll(limited)
-			if err != nil {
-				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (1)")
-				return
-			}
-
-			zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
-			if err != nil {
+			// the zip is read in place, attachments are only streamed
+			if hdr.Size > maxZipUpload {
 				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (2)")
+					"Please upload a WhatsApp chat export: .zip or .txt. (1)")
 				return
 			}
 
-			if len(zr.File) < 1 {
+			exp, err = pkg.ReadZipExport(upFile, hdr.Size, pkg.ExportLimits{Chat: maxUncompressed, Media: maxMedia, Files: maxZipFiles})
+			switch {
+			case errors.Is(err, pkg.ErrNoChatInZip):
 				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (3)")
+					"Please upload a WhatsApp chat export: .zip or .txt. (4)")
 				return
-			}
-
-			zf := zr.File[0]
-			if !strings.HasSuffix(strings.ToLower(zf.Name), ".txt") {
+			case errors.Is(err, pkg.ErrExportTooLarge):
 				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (4)")
+					"Please upload a WhatsApp chat export: .zip or .txt. (5)")
 				return
-			}
-			if zf.UncompressedSize64 > maxUncompressed {
+			case err != nil:
 				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (5)")
+					"Please upload a WhatsApp chat export: .zip or .txt. (2)")
 				return
 			}
 
-			rc, err := zf.Open()
+		default:
+			c.JSON(http.StatusBadRequest,
+				"Please upload a WhatsApp chat export: .zip or .txt, or a Telegram result.json. (8)")
+			return
+		}
+
+		// consent defaults to true; "false" skips the archive entirely
+		consent := true
+		if v := c.PostForm("consent"); v != "" {
+			consent, err = strconv.ParseBool(v)
 			if err != nil {
-				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (6)")
+				c.JSON(http.StatusBadRequest, "consent must be true or false.")
 				return
 			}
-			defer rc.Close()
+		}
 
-			body, err := io.ReadAll(&io.LimitedReader{R: rc, N: maxUncompressed})
+		// REDACT sets the default categories, the form can override them
+		categories := defaultRedact
+		if v, ok := c.GetPostForm("redact"); ok {
+			categories, err = pkg.ParseRedactCategories(v)
 			if err != nil {
-				c.JSON(http.StatusBadRequest,
-					"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (7)")
+				c.JSON(http.StatusBadRequest, "redact must be none or a list of phone, email and card.")
 				return
 			}
-			txt = string(body)
+		}
+		redactor := pkg.NewRedactor(categories)
 
-		default:
-			c.JSON(http.StatusBadRequest,
-				"Please upload a WhatsApp chat export: .zip or .txt (wihtout media). (8)")
+		// either year=2024 or from/to dates, both inclusive; unset analyses
+		// the whole chat
+		dateRange, err := pkg.ParseDateRange(c.PostForm("year"), c.PostForm("from"), c.PostForm("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "Please pick either a year or from/to dates formatted as YYYY-MM-DD.")
+			return
+		}
+
+		// tz is an IANA zone, tzOffset the browser's getTimezoneOffset();
+		// without either the zone is guessed from the browser's language
+		location, err := pkg.ResolveLocation(c.PostForm("tz"), c.PostForm("tzOffset"), c.GetHeader("Accept-Language"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "tz must be a time zone such as Europe/Sofia.")
+			return
+		}
+
+		// dateOrder=dmy|mdy settles exports whose dates could be read
+		// either way, see ErrCodeAmbiguousDateOrder
+		dateOrder, err := pkg.ParseDateOrder(c.PostForm("dateOrder"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "dateOrder must be dmy or mdy.")
 			return
 		}
 
 		id := uuid.New().String()
-		fn := id + ".txt"
-		pkg.DumpToR2(fn, []byte(txt))
+		token, err := newDeleteToken()
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{ErrCodeInternal, "Something went wrong while analysing your chat.", 0})
+			return
+		}
+
+		// the job id is only known to the uploader, unlike the result id
+		// which ends up in shared links
+		jobID := uuid.New().String()
+		done, err := jobs.Submit(jobID, func() (Output, error) {
+			out, err := analyse(exp, analyseOptions{redactor, dateRange, pkg.ParseOptions{Location: location, DateOrder: dateOrder}})
+			if err != nil {
+				return Output{}, err
+			}
+
+			// only archive chats that made it through the analysis, so a
+			// failed or rejected upload never leaves a chat behind that the
+			// uploader has no delete token for
+			share := &Share{ID: id, DeleteToken: token}
+			share.Archived = archive.SaveIfConsented(context.Background(), consent, id, exp.Text, redactor, token)
+
+			expiresAt, err := results.Save(context.Background(), id, out, token)
+			if err != nil {
+				log.Println(err)
+			} else {
+				share.ExpiresAt = &expiresAt
+			}
+
+			out.Share = share
+			return out, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+				ErrCodeBusy,
+				"We are analysing a lot of chats right now, please try again in a minute.",
+				0,
+			})
+			return
+		}
+
+		if c.Query("async") == "true" {
+			c.JSON(http.StatusAccepted, gin.H{"id": jobID})
+			return
+		}
+
+		<-done
+		job, _ := jobs.Get(jobID)
+		if job.Status == JobFailed {
+			abortWithParseError(c, job.err)
+			return
+		}
+
+		c.JSON(http.StatusOK, job.Output)
+	})
+
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		job, ok := jobs.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				ErrCodeNotFound,
+				"This analysis does not exist or has expired.",
+				0,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	})
 
-		rawLines := pkg.GetRawLines(txt)
-		db, err := sql.Open("duckdb", "")
-		pkg.Invariant(err == nil, "failed to connect to duckdb", err)
-		defer db.Close()
-		pkg.PrepDB(db, rawLines)
+	r.GET("/results/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{ErrCodeNotFound, "This result does not exist or has expired.", 0})
+			return
+		}
+
+		res, err := results.Load(c, id)
+		if errors.Is(err, pkg.ErrNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{ErrCodeNotFound, "This result does not exist or has expired.", 0})
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{ErrCodeInternal, "Could not load this result.", 0})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.DELETE("/uploads/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{ErrCodeNotFound, "This upload does not exist or has expired.", 0})
+			return
+		}
 
-		stats := pkg.GetStats(db)
-		cards := pkg.AssignCards(db, stats)
+		// erase everything we kept from this upload: the chat and its result
+		token := c.GetHeader("X-Delete-Token")
+		errs := []error{
+			archive.Delete(c, id, token),
+			results.Delete(c, id, token),
+		}
 
-		out := Output{
-			stats, cards,
+		found := false
+		for _, err := range errs {
+			switch {
+			case errors.Is(err, pkg.ErrNotFound):
+				continue
+			case errors.Is(err, ErrBadDeleteToken):
+				c.JSON(http.StatusForbidden, ErrorResponse{ErrCodeForbidden, "You are not allowed to delete this upload.", 0})
+				return
+			case err != nil:
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, ErrorResponse{ErrCodeInternal, "Could not delete this upload.", 0})
+				return
+			}
+			found = true
 		}
 
-		c.JSON(http.StatusOK, out)
+		if !found {
+			c.JSON(http.StatusNotFound, ErrorResponse{ErrCodeNotFound, "This upload does not exist or has expired.", 0})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	r.DELETE("/results/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{ErrCodeNotFound, "This result does not exist or has expired.", 0})
+			return
+		}
+
+		err := results.Delete(c, id, c.GetHeader("X-Delete-Token"))
+		switch {
+		case errors.Is(err, pkg.ErrNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{ErrCodeNotFound, "This result does not exist or has expired.", 0})
+		case errors.Is(err, ErrBadDeleteToken):
+			c.JSON(http.StatusForbidden, ErrorResponse{ErrCodeForbidden, "You are not allowed to delete this result.", 0})
+		case err != nil:
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{ErrCodeInternal, "Could not delete this result.", 0})
+		default:
+			c.Status(http.StatusNoContent)
+		}
 	})
 
 	c := cron.New()
@@ -193,6 +404,9 @@ func main() {
 
 		defer f.Close()
 	})
+	c.AddFunc("* * * * *", jobs.Sweep)
+	c.AddFunc("0 * * * *", results.Sweep)
+	c.AddFunc("30 * * * *", archive.Sweep)
 	c.Start()
 
 	r.Run()
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DayStreak is a run of Days consecutive days, Start and End included,
+// formatted as 2006-01-02.
+type DayStreak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// PersonActivity is how many days a sender wrote on, and their longest run
+// of consecutive ones.
+type PersonActivity struct {
+	Sender        string    `json:"sender"`
+	ActiveDays    int       `json:"activeDays"`
+	LongestStreak DayStreak `json:"longestStreak"`
+}
+
+// Activity is how many days the group was alive, counted in the export's
+// local dates.
+type Activity struct {
+	ActiveDays    int       `json:"activeDays"`
+	LongestStreak DayStreak `json:"longestStreak"`
+	// LongestDeadPeriod is the longest run of days without a message
+	// between the first and the last one, zero if there was none
+	LongestDeadPeriod DayStreak `json:"longestDeadPeriod"`
+	// PerPerson is sorted longest streak first
+	PerPerson []PersonActivity `json:"perPerson"`
+}
+
+// activity reads the group's and every sender's daily streaks from
+// `daily_runs`, which prep.sql builds, or returns an error.
+func activity(db *sql.DB) (Activity, error) {
+	rows, err := db.Query(ActivityQuery)
+	if err != nil {
+		return Activity{}, fmt.Errorf("failed to create daily streaks query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := Activity{PerPerson: []PersonActivity{}}
+	for rows.Next() {
+		var (
+			sender     sql.NullString
+			activeDays int
+			streak     DayStreak
+			start, end time.Time
+		)
+		if err := rows.Scan(&sender, &activeDays, &streak.Days, &start, &end); err != nil {
+			return Activity{}, fmt.Errorf("failed to scan daily streaks: %w", err)
+		}
+		streak.Start, streak.End = start.Format("2006-01-02"), end.Format("2006-01-02")
+
+		if !sender.Valid {
+			ret.ActiveDays, ret.LongestStreak = activeDays, streak
+			continue
+		}
+		ret.PerPerson = append(ret.PerPerson, PersonActivity{strings.Replace(sender.String, "- ", "", 1), activeDays, streak})
+	}
+
+	if err := rows.Err(); err != nil {
+		return Activity{}, fmt.Errorf("iteration error for daily streaks: %w", err)
+	}
+
+	var start, end time.Time
+	err = db.QueryRow(DeadPeriodQuery).Scan(&start, &end, &ret.LongestDeadPeriod.Days)
+	if err == sql.ErrNoRows {
+		return ret, nil
+	}
+	if err != nil {
+		return Activity{}, fmt.Errorf("failed to find longest dead period: %w", err)
+	}
+	ret.LongestDeadPeriod.Start, ret.LongestDeadPeriod.End = start.Format("2006-01-02"), end.Format("2006-01-02")
+	return ret, nil
+}
@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+)
+
+// ArchivePrefixes are where archived chats live, current layout first.
+// Chats archived before uploads got their own prefix sit at the bucket root
+// until the retention sweep removes them.
+var ArchivePrefixes = []string{"uploads/", ""}
+
+// ArchiveChatKey is the key an archived chat is saved under.
+func ArchiveChatKey(prefix, id string) string {
+	return prefix + id + ".txt"
+}
+
+// ArchiveOwnerKey is the key of the hash of the delete token that goes with
+// an archived chat.
+func ArchiveOwnerKey(prefix, id string) string {
+	return prefix + id + ".owner"
+}
+
+// ReadArchive returns the plain text of the chat archived under id,
+// wherever in ArchivePrefixes it is.
+func ReadArchive(ctx context.Context, s Storage, id string, keys *KeyRing) ([]byte, error) {
+	for _, prefix := range ArchivePrefixes {
+		data, err := s.Get(ctx, ArchiveChatKey(prefix, id))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return OpenArchive(data, keys)
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Attachment is a media file shipped next to the chat in a zip export.
+type Attachment struct {
+	Name string `json:"name"`
+	// Size is in bytes
+	Size int64 `json:"size"`
+	// Type is the MIME type, such as "image/jpeg"
+	Type string `json:"type"`
+}
+
+// contentType sniffs the type of a file from its first bytes, falling back
+// to its extension for formats net/http doesn't know, like .opus.
+func contentType(name string, head []byte) string {
+	t := http.DetectContentType(head)
+	if t == "application/octet-stream" || strings.HasPrefix(t, "text/plain") {
+		if byExt := mime.TypeByExtension(path.Ext(name)); byExt != "" {
+			t = byExt
+		}
+	}
+	t, _, _ = strings.Cut(t, ";")
+	return t
+}
+
+// iOS writes "<attached: 00000012-PHOTO-2024-08-06-11-45-41.jpg>", Android
+// "IMG-20240806-WA0001.jpg (file attached)" in the chat's language.
+var attachedR = regexp.MustCompile(`<attached: (.+?)>`)
+
+// attachmentName is the file a message says it carries, if any.
+func attachmentName(text string) string {
+	if g := attachedR.FindStringSubmatch(text); g != nil {
+		return g[1]
+	}
+	line, _, _ := strings.Cut(text, "\n")
+	name, _, _ := strings.Cut(line, " (")
+	return strings.TrimSpace(name)
+}
+
+// linkAttachments points every message that names one of attachments at it.
+func linkAttachments(messages []Message, attachments []Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+
+	byName := make(map[string]*Attachment, len(attachments))
+	for i := range attachments {
+		byName[attachments[i].Name] = &attachments[i]
+	}
+	for i, m := range messages {
+		if a, ok := byName[attachmentName(m.Text)]; ok {
+			messages[i].Attachment = a
+		}
+	}
+}
+
+type MediaVolume struct {
+	Sender string  `json:"sender"`
+	Files  int     `json:"files"`
+	MB     float64 `json:"mb"`
+}
+
+type FileType struct {
+	Type  string  `json:"type"`
+	Files int     `json:"files"`
+	MB    float64 `json:"mb"`
+}
+
+type LargestAttachment struct {
+	Sender    string    `json:"sender"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	MB        float64   `json:"mb"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AttachmentStats describe the media of a zip exported "with media". They
+// are empty for any other export.
+type AttachmentStats struct {
+	VolumePerPerson []MediaVolume      `json:"volumePerPerson"`
+	FileTypes       []FileType         `json:"fileTypes"`
+	Largest         *LargestAttachment `json:"largest"`
+	// Partial means the export had more media than could be read, so the
+	// numbers only cover part of it. GetStats can't tell, callers copy
+	// Export.AttachmentsPartial here.
+	Partial bool `json:"partial"`
+}
+
+func megabytes(bytes int64) float64 {
+	return math.Round(float64(bytes)/(1<<20)*100) / 100
+}
+
+// attachmentStats sums up the attachments sent in `chat`.
+func attachmentStats(db *sql.DB) (AttachmentStats, error) {
+	ret := AttachmentStats{[]MediaVolume{}, []FileType{}, nil, false}
+
+	rows, err := db.Query(`SELECT msg_sender, count(*), sum(attachment_size)::BIGINT AS size
+		FROM chat
+		WHERE attachment_name IS NOT NULL
+		GROUP BY msg_sender
+		ORDER BY size DESC, msg_sender;`)
+	if err != nil {
+		return AttachmentStats{}, fmt.Errorf("failed to create media volume query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			v    MediaVolume
+			size int64
+		)
+		if err := rows.Scan(&v.Sender, &v.Files, &size); err != nil {
+			return AttachmentStats{}, fmt.Errorf("failed to scan media volume: %w", err)
+		}
+		v.Sender = strings.Replace(v.Sender, "- ", "", 1)
+		v.MB = megabytes(size)
+		ret.VolumePerPerson = append(ret.VolumePerPerson, v)
+	}
+	if err := rows.Err(); err != nil {
+		return AttachmentStats{}, fmt.Errorf("iteration error for media volume: %w", err)
+	}
+
+	rows, err = db.Query(`SELECT attachment_type, count(*) AS files, sum(attachment_size)::BIGINT
+		FROM chat
+		WHERE attachment_name IS NOT NULL
+		GROUP BY attachment_type
+		ORDER BY files DESC, attachment_type;`)
+	if err != nil {
+		return AttachmentStats{}, fmt.Errorf("failed to create file types query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			t    FileType
+			size int64
+		)
+		if err := rows.Scan(&t.Type, &t.Files, &size); err != nil {
+			return AttachmentStats{}, fmt.Errorf("failed to scan file types: %w", err)
+		}
+		t.MB = megabytes(size)
+		ret.FileTypes = append(ret.FileTypes, t)
+	}
+	if err := rows.Err(); err != nil {
+		return AttachmentStats{}, fmt.Errorf("iteration error for file types: %w", err)
+	}
+
+	var (
+		largest   LargestAttachment
+		size      int64
+		utc, wall time.Time
+	)
+	err = db.QueryRow(`SELECT msg_sender, attachment_name, attachment_type, attachment_size, msg_utc, msg_timestamp
+		FROM chat
+		WHERE attachment_name IS NOT NULL
+		ORDER BY attachment_size DESC, msg_id
+		LIMIT 1;`).Scan(&largest.Sender, &largest.Name, &largest.Type, &size, &utc, &wall)
+	if err == sql.ErrNoRows {
+		return ret, nil
+	}
+	if err != nil {
+		return AttachmentStats{}, fmt.Errorf("failed to find largest attachment: %w", err)
+	}
+	largest.Sender = strings.Replace(largest.Sender, "- ", "", 1)
+	largest.MB = megabytes(size)
+	largest.Timestamp = withOffset(utc, wall)
+	ret.Largest = &largest
+	return ret, nil
+}
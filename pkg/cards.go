@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"database/sql"
+	"maps"
 	"math"
 	"math/rand"
 	"slices"
@@ -13,24 +14,47 @@ import (
 // the bot: least average words per message
 // jester: most laughing emojis
 // lurker: least messages sent
-// spammer: most images and videos and audio sent
+// spammer: most images and videos and audio (or media of unknown type) sent
 // core: most messages sent
 // tim cheese: random drop
 // basic bitch: most ending y's on hey on average
+// fastest fingers: lowest median reply time
+// slowpoke: highest median reply time
+// ghosted: most conversations started that nobody joined
+// double texter: most bursts of two messages or more in a row
 
 var CardTypes = []string{
 	"GRANDMA", "OPENER", "BOT",
 	"JESTER", "LURKER", "SPAMMER",
-	"CORE", "BASICBITCH",
+	"CORE", "BASICBITCH", "FASTESTFINGERS",
+	"SLOWPOKE", "GHOSTED", "DOUBLETEXTER",
 }
 
+// minRepliesForCard keeps a sender who answered once or twice from winning
+// FASTESTFINGERS or SLOWPOKE by luck.
+const minRepliesForCard = 5
+
+// minStartedForCard does the same for GHOSTED: one ignored "hi" out of one
+// isn't a pattern.
+const minStartedForCard = 5
+
+// minBurstsForCard does the same for DOUBLETEXTER.
+const minBurstsForCard = 10
+
 type Card struct {
 	Person string `json:"person"`
 	Type   string `json:"type"`
 	Value  int    `json:"value"`
 }
 
+// AssignCards picks up to five cards with a randomly seeded generator.
 func AssignCards(db *sql.DB, stats Stats) []Card {
+	return AssignCardsRand(db, stats, rand.New(rand.NewSource(rand.Int63())))
+}
+
+// AssignCardsRand is AssignCards with a caller-provided generator, so that a
+// fixed seed always deals the same cards.
+func AssignCardsRand(db *sql.DB, stats Stats, rng *rand.Rand) []Card {
 	cards := make(map[string]*Card)
 
 	if len(stats.MessagesPerPerson) <= 0 {
@@ -87,26 +111,22 @@ func AssignCards(db *sql.DB, stats Stats) []Card {
 		stats.MessagesPerPerson[len(stats.MessagesPerPerson)-1].Count,
 	}
 
+	// every attachment but stickers, which are GRANDMA's; this includes
+	// media of unknown type so Android exports without media count too
 	mediaCounts := make(map[string]int)
-	for i := range len(stats.MessagesPerPerson) {
-		mediaCounts[stats.MessagesPerPerson[i].Sender] = 0
-	}
-
-	for _, v := range stats.AudioPerPerson {
+	for _, v := range stats.MediaPerPerson {
 		mediaCounts[v.Sender] += v.Count
 	}
-	for _, v := range stats.ImagesPerPerson {
-		mediaCounts[v.Sender] += v.Count
-	}
-	for _, v := range stats.VideosPerPerson {
-		mediaCounts[v.Sender] += v.Count
+	for _, v := range stats.StickersPerPerson {
+		mediaCounts[v.Sender] -= v.Count
 	}
 
+	// walk senders in message order, not map order, so ties are stable
 	spammer := ""
 	spammerCount := 0
-	for k, v := range mediaCounts {
-		if v > spammerCount {
-			spammer = k
+	for _, p := range stats.MessagesPerPerson {
+		if v := mediaCounts[p.Sender]; v > spammerCount {
+			spammer = p.Sender
 			spammerCount = v
 		}
 	}
@@ -135,14 +155,68 @@ func AssignCards(db *sql.DB, stats Stats) []Card {
 		}
 	}
 
+	// ReplyTimes is sorted fastest first. Only answers within a
+	// conversation count, so restarting a dead chat doesn't make anyone
+	// a SLOWPOKE.
+	var repliers []ReplyTime
+	for _, r := range stats.ReplyTimes {
+		if r.Replies >= minRepliesForCard {
+			repliers = append(repliers, r)
+		}
+	}
+	if len(repliers) >= 2 {
+		fastest, slowest := repliers[0], repliers[len(repliers)-1]
+		if fastest.MedianSeconds < slowest.MedianSeconds {
+			cards["FASTESTFINGERS"] = &Card{
+				fastest.Sender,
+				"FASTESTFINGERS",
+				fastest.MedianSeconds,
+			}
+			cards["SLOWPOKE"] = &Card{
+				slowest.Sender,
+				"SLOWPOKE",
+				slowest.MedianSeconds,
+			}
+		}
+	}
+
+	// MostIgnored is sorted by the share ignored, highest first
+	for _, c := range stats.MostIgnored {
+		if c.Started >= minStartedForCard {
+			if c.Ignored > 0 {
+				cards["GHOSTED"] = &Card{c.Sender, "GHOSTED", c.Percent}
+			}
+			break
+		}
+	}
+
+	// by the share of bursts that are double texts, or the busiest sender
+	// would always win
+	var doubleTexter *Streak
+	for i, s := range stats.Streaks {
+		if s.Bursts < minBurstsForCard || s.DoubleTexts == 0 {
+			continue
+		}
+		if doubleTexter == nil || s.DoubleTexts*doubleTexter.Bursts > doubleTexter.DoubleTexts*s.Bursts {
+			doubleTexter = &stats.Streaks[i]
+		}
+	}
+	if doubleTexter != nil {
+		cards["DOUBLETEXTER"] = &Card{
+			doubleTexter.Sender,
+			"DOUBLETEXTER",
+			int(math.Round(100 * float64(doubleTexter.DoubleTexts) / float64(doubleTexter.Bursts))),
+		}
+	}
+
 	calculatedCards := []Card{}
-	for _, v := range cards {
-		if v != nil {
+	for _, t := range slices.Sorted(maps.Keys(cards)) {
+		if v := cards[t]; v != nil {
 			calculatedCards = append(calculatedCards, *v)
 		}
 	}
 
-	rand.Shuffle(len(calculatedCards), func(i, j int) { calculatedCards[i], calculatedCards[j] = calculatedCards[j], calculatedCards[i] })
+	rng.Shuffle(len(calculatedCards), func(i, j int) { calculatedCards[i], calculatedCards[j] = calculatedCards[j], calculatedCards[i] })
 	usedCards := []string{}
 	cardCount := min(len(calculatedCards), min(len(stats.MessagesPerPerson), 5))
 	ret := []Card{}
@@ -153,7 +227,7 @@ func AssignCards(db *sql.DB, stats Stats) []Card {
 		}
 
 		if !slices.Contains(usedCards, "TIMECHEESE") {
-			chance := rand.Int63n(10000)
+			chance := rng.Int63n(10000)
 			if chance == 1337 {
 				usedCards = append(usedCards, "TIMECHEESE")
 				ret = append(ret, Card{
@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// Delta is a number in the analysed period next to the same number in the
+// period before it.
+type Delta struct {
+	Previous int `json:"previous"`
+	Current  int `json:"current"`
+	Change   int `json:"change"`
+	// Percent is nil when the previous value is 0
+	Percent *float64 `json:"percent"`
+}
+
+func newDelta(previous, current int) Delta {
+	d := Delta{previous, current, current - previous, nil}
+	if previous != 0 {
+		p := math.Round(float64(d.Change)/float64(previous)*1000) / 10
+		d.Percent = &p
+	}
+	return d
+}
+
+type PersonDelta struct {
+	Sender   string `json:"sender"`
+	Messages Delta  `json:"messages"`
+	Images   Delta  `json:"images"`
+	Videos   Delta  `json:"videos"`
+	Audio    Delta  `json:"audio"`
+	Stickers Delta  `json:"stickers"`
+	Media    Delta  `json:"media"`
+}
+
+type EmojiDelta struct {
+	Emoji string `json:"emoji"`
+	Count Delta  `json:"count"`
+}
+
+type CoupleChange struct {
+	Previous Couple `json:"previous"`
+	Current  Couple `json:"current"`
+	Changed  bool   `json:"changed"`
+}
+
+// Comparison sets the analysed period against the one right before it.
+type Comparison struct {
+	PreviousFirstMessage time.Time     `json:"previousFirstMessage"`
+	PreviousLastMessage  time.Time     `json:"previousLastMessage"`
+	TotalMessages        Delta         `json:"totalMessages"`
+	TotalConversations   Delta         `json:"totalConversations"`
+	People               []PersonDelta `json:"people"`
+	Emojis               []EmojiDelta  `json:"emojis"`
+	Couple               CoupleChange  `json:"couple"`
+	NewMembers           []string      `json:"newMembers"`
+	DepartedMembers      []string      `json:"departedMembers"`
+}
+
+// GetComparison compares current, the stats of r, with the period right
+// before r (see DateRange.Previous). db has to be prepared for r and is
+// prepared for r again when GetComparison returns, so cards can be assigned
+// afterwards. It returns nil if r is open or nobody wrote anything in the
+// previous period.
+func GetComparison(db *sql.DB, current Stats, r DateRange) (*Comparison, error) {
+	prev, ok := r.Previous()
+	if !ok {
+		return nil, nil
+	}
+
+	currentEmojis, err := emojiCounts(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		previous       Stats
+		previousEmojis map[string]int
+	)
+	err = PrepRange(db, prev)
+	empty := errors.Is(err, ErrEmptyChat)
+	if err != nil && !empty {
+		return nil, err
+	}
+	if !empty {
+		previous = GetStats(db)
+		previousEmojis, err = emojiCounts(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := PrepRange(db, r); err != nil {
+		return nil, err
+	}
+	if empty {
+		return nil, nil
+	}
+
+	return compareStats(previous, current, previousEmojis, currentEmojis), nil
+}
+
+func compareStats(previous, current Stats, previousEmojis, currentEmojis map[string]int) *Comparison {
+	c := &Comparison{
+		PreviousFirstMessage: previous.FirstMessage,
+		PreviousLastMessage:  previous.LastMessage,
+		TotalMessages:        newDelta(previous.TotalMessages, current.TotalMessages),
+		TotalConversations:   newDelta(previous.TotalConversations, current.TotalConversations),
+		Couple: CoupleChange{
+			previous.Duo,
+			current.Duo,
+			previous.Duo.PersonOne != current.Duo.PersonOne || previous.Duo.PersonTwo != current.Duo.PersonTwo,
+		},
+		NewMembers:      []string{},
+		DepartedMembers: []string{},
+	}
+
+	prevMessages := messageCounts(previous.MessagesPerPerson)
+	curMessages := messageCounts(current.MessagesPerPerson)
+	prevImages, curImages := mediaCounts(previous.ImagesPerPerson), mediaCounts(current.ImagesPerPerson)
+	prevVideos, curVideos := mediaCounts(previous.VideosPerPerson), mediaCounts(current.VideosPerPerson)
+	prevAudio, curAudio := mediaCounts(previous.AudioPerPerson), mediaCounts(current.AudioPerPerson)
+	prevStickers, curStickers := mediaCounts(previous.StickersPerPerson), mediaCounts(current.StickersPerPerson)
+	prevMedia, curMedia := mediaCounts(previous.MediaPerPerson), mediaCounts(current.MediaPerPerson)
+
+	for sender := range curMessages {
+		if _, ok := prevMessages[sender]; !ok {
+			c.NewMembers = append(c.NewMembers, sender)
+		}
+	}
+	for sender := range prevMessages {
+		if _, ok := curMessages[sender]; !ok {
+			c.DepartedMembers = append(c.DepartedMembers, sender)
+		}
+	}
+	slices.Sort(c.NewMembers)
+	slices.Sort(c.DepartedMembers)
+
+	senders := slices.Concat(slices.Collect(maps.Keys(curMessages)), c.DepartedMembers)
+	for _, sender := range ranked(senders, prevMessages, curMessages) {
+		c.People = append(c.People, PersonDelta{
+			sender,
+			newDelta(prevMessages[sender], curMessages[sender]),
+			newDelta(prevImages[sender], curImages[sender]),
+			newDelta(prevVideos[sender], curVideos[sender]),
+			newDelta(prevAudio[sender], curAudio[sender]),
+			newDelta(prevStickers[sender], curStickers[sender]),
+			newDelta(prevMedia[sender], curMedia[sender]),
+		})
+	}
+
+	// only the emojis that made either top 3, the full list is mostly noise
+	var emojis []string
+	for _, e := range slices.Concat(current.Top3Emojis, previous.Top3Emojis) {
+		if !slices.Contains(emojis, e.Emoji) {
+			emojis = append(emojis, e.Emoji)
+		}
+	}
+	for _, emoji := range ranked(emojis, previousEmojis, currentEmojis) {
+		c.Emojis = append(c.Emojis, EmojiDelta{emoji, newDelta(previousEmojis[emoji], currentEmojis[emoji])})
+	}
+
+	return c
+}
+
+func messageCounts(m []MessagePerPerson) map[string]int {
+	ret := make(map[string]int)
+	for _, x := range m {
+		ret[x.Sender] = x.Count
+	}
+	return ret
+}
+
+func mediaCounts(m []MediaCount) map[string]int {
+	ret := make(map[string]int)
+	for _, x := range m {
+		ret[x.Sender] = x.Count
+	}
+	return ret
+}
+
+// ranked orders keys by their current value, then their previous value,
+// highest first, and alphabetically after that.
+func ranked(keys []string, previous, current map[string]int) []string {
+	slices.SortFunc(keys, func(x, y string) int {
+		return cmp.Or(
+			cmp.Compare(current[y], current[x]),
+			cmp.Compare(previous[y], previous[x]),
+			cmp.Compare(x, y),
+		)
+	})
+	return keys
+}
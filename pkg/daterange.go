@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// DateRange limits the analysis to messages sent in [From, To). A zero
+// bound is open, so the zero DateRange covers the whole chat. Timestamps
+// are compared as written in the export, like everywhere else.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// YearRange covers a single calendar year.
+func YearRange(year int) DateRange {
+	return DateRange{
+		time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// ParseDateRange builds a range from user input: either a year such as
+// "2024", or from and/or to dates formatted as 2006-01-02. Both dates are
+// inclusive. Empty strings leave that side of the range open.
+func ParseDateRange(year, from, to string) (DateRange, error) {
+	if year != "" {
+		if from != "" || to != "" {
+			return DateRange{}, errors.New("year can't be combined with from or to")
+		}
+
+		y, err := strconv.Atoi(year)
+		if err != nil || y < 1 || y > 9999 {
+			return DateRange{}, fmt.Errorf("invalid year %q", year)
+		}
+		return YearRange(y), nil
+	}
+
+	var r DateRange
+	if from != "" {
+		t, err := time.Parse(dateLayout, from)
+		if err != nil {
+			return DateRange{}, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", from)
+		}
+		r.From = t
+	}
+	if to != "" {
+		t, err := time.Parse(dateLayout, to)
+		if err != nil {
+			return DateRange{}, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", to)
+		}
+		r.To = t.AddDate(0, 0, 1)
+	}
+
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return DateRange{}, errors.New("from must not be after to")
+	}
+	return r, nil
+}
+
+// Previous returns the period of the same length that ends where r starts.
+// Ranges made of whole months, such as years, step back by calendar months
+// so that 2024 is compared with 2023. It returns false for open ranges.
+func (r DateRange) Previous() (DateRange, bool) {
+	if r.From.IsZero() || r.To.IsZero() {
+		return DateRange{}, false
+	}
+
+	if months, ok := wholeMonths(r.From, r.To); ok {
+		return DateRange{r.From.AddDate(0, -months, 0), r.From}, true
+	}
+	return DateRange{r.From.Add(-r.To.Sub(r.From)), r.From}, true
+}
+
+// wholeMonths returns how many months lie between from and to if both are
+// midnight on the first of a month.
+func wholeMonths(from, to time.Time) (int, bool) {
+	isMonthStart := func(t time.Time) bool {
+		return t.Day() == 1 && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+	}
+	if !isMonthStart(from) || !isMonthStart(to) {
+		return 0, false
+	}
+	return (to.Year()-from.Year())*12 + int(to.Month()-from.Month()), true
+}
+
+// bounds returns the range as query arguments, with nil for open sides.
+func (r DateRange) bounds() (from, to any) {
+	if !r.From.IsZero() {
+		from = r.From
+	}
+	if !r.To.IsZero() {
+		to = r.To
+	}
+	return from, to
+}
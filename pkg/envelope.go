@@ -0,0 +1,224 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Envelope layout (all lengths big-endian):
+//
+//	"GWE1" | u8 len(keyID) | keyID | u16 len(wrappedKey) | wrappedKey | nonce | ciphertext
+//
+// wrappedKey is the per-object AES-256 data key sealed with the master key
+// named keyID, ciphertext is the payload sealed with the data key. Both
+// use AES-GCM with the header up to and including wrappedKey as
+// additional data, so the key id can't be swapped.
+var envelopeMagic = []byte("GWE1")
+
+// MetaKeyID is the object metadata field holding the master key id of an
+// encrypted object.
+const MetaKeyID = "key-id"
+
+var (
+	ErrNotEnvelope   = errors.New("data is not an encrypted envelope")
+	ErrUnknownKeyID  = errors.New("envelope is sealed with an unknown master key")
+	ErrBadMasterKeys = errors.New("ARCHIVE_MASTER_KEYS must look like id:base64key[,id:base64key...] with 32-byte keys")
+)
+
+// KeyRing holds the master keys used to wrap data keys. The current key
+// seals new objects; every key can open old ones, so keys can be rotated
+// by prepending a new one.
+type KeyRing struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyRing builds a key ring whose first key is the current one.
+func NewKeyRing(ids []string, keys [][]byte) (*KeyRing, error) {
+	if len(ids) == 0 || len(ids) != len(keys) {
+		return nil, ErrBadMasterKeys
+	}
+
+	k := &KeyRing{ids[0], make(map[string][]byte)}
+	for i, id := range ids {
+		if len(id) == 0 || len(id) > 255 || len(keys[i]) != 32 {
+			return nil, ErrBadMasterKeys
+		}
+		k.keys[id] = keys[i]
+	}
+	return k, nil
+}
+
+// NewKeyRingFromEnv parses ARCHIVE_MASTER_KEYS. It returns nil and no error
+// if the variable is unset; the server only accepts that together with
+// ARCHIVE_PLAINTEXT=true.
+func NewKeyRingFromEnv() (*KeyRing, error) {
+	v := os.Getenv("ARCHIVE_MASTER_KEYS")
+	if v == "" {
+		return nil, nil
+	}
+
+	var (
+		ids  []string
+		keys [][]byte
+	)
+	for _, entry := range strings.Split(v, ",") {
+		id, b64, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, ErrBadMasterKeys
+		}
+
+		key, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, ErrBadMasterKeys
+		}
+
+		ids = append(ids, id)
+		keys = append(keys, key)
+	}
+
+	return NewKeyRing(ids, keys)
+}
+
+// CurrentKeyID is the id of the master key Seal uses.
+func (k *KeyRing) CurrentKeyID() string {
+	return k.current
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the current
+// master key.
+func (k *KeyRing) Seal(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	header := &bytes.Buffer{}
+	header.Write(envelopeMagic)
+	header.WriteByte(byte(len(k.current)))
+	header.WriteString(k.current)
+
+	wrapped, err := gcmSeal(k.keys[k.current], dataKey, header.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	header.Write(binary.BigEndian.AppendUint16(nil, uint16(len(wrapped))))
+	header.Write(wrapped)
+
+	sealed, err := gcmSeal(dataKey, plaintext, header.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt payload: %w", err)
+	}
+
+	return append(header.Bytes(), sealed...), nil
+}
+
+// Open decrypts an envelope produced by Seal with any key of the ring.
+func (k *KeyRing) Open(envelope []byte) ([]byte, error) {
+	keyID, err := EnvelopeKeyID(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+
+	idEnd := len(envelopeMagic) + 1 + len(keyID)
+	if len(envelope) < idEnd+2 {
+		return nil, ErrNotEnvelope
+	}
+	wrappedLen := int(binary.BigEndian.Uint16(envelope[idEnd:]))
+	wrappedEnd := idEnd + 2 + wrappedLen
+	if len(envelope) < wrappedEnd {
+		return nil, ErrNotEnvelope
+	}
+
+	dataKey, err := gcmOpen(master, envelope[idEnd+2:wrappedEnd], envelope[:idEnd])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	plaintext, err := gcmOpen(dataKey, envelope[wrappedEnd:], envelope[:wrappedEnd])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+// OpenArchive returns the plain text of an archived chat: envelopes are
+// decrypted with keys, chats archived before encryption are returned as is.
+func OpenArchive(data []byte, keys *KeyRing) ([]byte, error) {
+	if !IsEnvelope(data) {
+		return data, nil
+	}
+	if keys == nil {
+		return nil, errors.New("archive is encrypted but no master keys are configured")
+	}
+	return keys.Open(data)
+}
+
+// IsEnvelope reports whether data looks like the output of Seal. Archives
+// written before encryption was enabled are plain text.
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// EnvelopeKeyID returns the id of the master key an envelope is sealed
+// with, without decrypting it.
+func EnvelopeKeyID(envelope []byte) (string, error) {
+	if !IsEnvelope(envelope) || len(envelope) < len(envelopeMagic)+1 {
+		return "", ErrNotEnvelope
+	}
+
+	n := int(envelope[len(envelopeMagic)])
+	start := len(envelopeMagic) + 1
+	if len(envelope) < start+n {
+		return "", ErrNotEnvelope
+	}
+	return string(envelope[start : start+n]), nil
+}
+
+// gcmSeal returns nonce || ciphertext.
+func gcmSeal(key, plaintext, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func gcmOpen(key, sealed, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrNotEnvelope
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additional)
+}
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func testKeyRing(t *testing.T, ids ...string) *KeyRing {
+	t.Helper()
+
+	var keys [][]byte
+	for i := range ids {
+		keys = append(keys, testKey(byte(i+1)))
+	}
+	k, err := NewKeyRing(ids, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testKeyRing(t, "k1")
+	chat := []byte("22/05/2025, 18:01 - Mila: hi")
+
+	sealed, err := k.Seal(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEnvelope(sealed) {
+		t.Error("sealed data is not recognised as an envelope")
+	}
+	if bytes.Contains(sealed, chat) {
+		t.Error("sealed data contains the plain text")
+	}
+	if id, err := EnvelopeKeyID(sealed); err != nil || id != "k1" {
+		t.Errorf("EnvelopeKeyID = %q, %v, want k1", id, err)
+	}
+
+	opened, err := k.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, chat) {
+		t.Errorf("Open = %q, want %q", opened, chat)
+	}
+
+	// plain text archives from before encryption pass through
+	if got, err := OpenArchive(chat, k); err != nil || !bytes.Equal(got, chat) {
+		t.Errorf("OpenArchive of plain text = %q, %v", got, err)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	k := testKeyRing(t, "k1")
+
+	sealed, err := k.Seal([]byte("secret chat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idEnd := len(envelopeMagic) + 1 + len("k1")
+	for name, i := range map[string]int{
+		"wrapped key length": idEnd + 1,
+		"wrapped key":        idEnd + 2,
+		"ciphertext":         len(sealed) - 1,
+	} {
+		tampered := bytes.Clone(sealed)
+		tampered[i] ^= 0x01
+		if _, err := k.Open(tampered); err == nil {
+			t.Errorf("Open accepted an envelope with a modified %s", name)
+		}
+	}
+
+	if _, err := k.Open(sealed[:len(sealed)-4]); err == nil {
+		t.Error("Open accepted a truncated envelope")
+	}
+
+	// the key id is authenticated: relabelling with another known key fails
+	other := testKeyRing(t, "k2", "k1")
+	relabelled := bytes.Clone(sealed)
+	copy(relabelled[len(envelopeMagic)+1:], "k2")
+	if _, err := other.Open(relabelled); err == nil {
+		t.Error("Open accepted an envelope whose key id was swapped")
+	}
+}
+
+func TestOpenUnknownKeyID(t *testing.T) {
+	sealed, err := testKeyRing(t, "old").Seal([]byte("secret chat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testKeyRing(t, "new").Open(sealed); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("Open returned %v, want ErrUnknownKeyID", err)
+	}
+	if _, err := OpenArchive(sealed, nil); err == nil {
+		t.Error("OpenArchive without keys returned an encrypted archive")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	before := testKeyRing(t, "2024")
+	old, err := before.Seal([]byte("archived in 2024"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key is prepended, the old one stays to open old archives
+	after, err := NewKeyRing([]string{"2025", "2024"}, [][]byte{testKey(9), testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.CurrentKeyID() != "2025" {
+		t.Errorf("CurrentKeyID = %q, want 2025", after.CurrentKeyID())
+	}
+
+	if got, err := after.Open(old); err != nil || string(got) != "archived in 2024" {
+		t.Errorf("Open of an archive under the old key = %q, %v", got, err)
+	}
+
+	sealed, err := after.Seal([]byte("archived in 2025"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := EnvelopeKeyID(sealed); id != "2025" {
+		t.Errorf("new archive is sealed with %q, want 2025", id)
+	}
+	if _, err := before.Open(sealed); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("the old ring opened a new archive: %v", err)
+	}
+}
+
+func TestNewKeyRingRejectsBadKeys(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ids  []string
+		keys [][]byte
+	}{
+		"no keys":     {nil, nil},
+		"short key":   {[]string{"k1"}, [][]byte{testKey(1)[:16]}},
+		"empty id":    {[]string{""}, [][]byte{testKey(1)}},
+		"missing key": {[]string{"k1", "k2"}, [][]byte{testKey(1)}},
+	} {
+		if _, err := NewKeyRing(tc.ids, tc.keys); !errors.Is(err, ErrBadMasterKeys) {
+			t.Errorf("%s: NewKeyRing returned %v, want ErrBadMasterKeys", name, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownFormat means the upload doesn't look like any export we can
+	// parse.
+	ErrUnknownFormat = errors.New("unknown chat export format")
+
+	// ErrEmptyChat means the export parsed but contained no messages from
+	// actual people.
+	ErrEmptyChat = errors.New("chat has no messages")
+
+	// ErrAmbiguousDateOrder means the export's dates can't tell day-first
+	// from month-first, so the order has to be passed explicitly.
+	ErrAmbiguousDateOrder = errors.New("can't tell whether dates are day-first or month-first")
+)
+
+// ErrBadTimestamp is returned when a line looks like the start of a message
+// but its timestamp can't be parsed. Line is 1-based and counts every line
+// of the upload; for Telegram exports it is the message id.
+type ErrBadTimestamp struct {
+	Line  int
+	Value string
+	Err   error
+}
+
+func (e ErrBadTimestamp) Error() string {
+	return fmt.Sprintf("bad timestamp %q on line %d: %v", e.Value, e.Line, e.Err)
+}
+
+func (e ErrBadTimestamp) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoChatInZip means the zip doesn't hold a chat export we can read.
+	ErrNoChatInZip = errors.New("zip does not contain a chat export")
+
+	// ErrExportTooLarge means the chat is bigger than the allowed size
+	// once uncompressed, or the zip holds too many files.
+	ErrExportTooLarge = errors.New("chat export is too large")
+
+	// errMediaBudget stops reading attachments once ExportLimits.Media is
+	// used up.
+	errMediaBudget = errors.New("media budget exhausted")
+)
+
+// Export is an uploaded export, read but not parsed yet.
+type Export struct {
+	// Ext is ".json" for Telegram exports and ".txt" for WhatsApp ones,
+	// zipped or not
+	Ext  string
+	Text string
+	// Attachments are the media files of a zip exported "with media"
+	Attachments []Attachment
+	// AttachmentsPartial is set if the media limit ran out before every
+	// attachment was read, so Attachments only holds the first ones
+	AttachmentsPartial bool
+}
+
+// ExportLimits bound how much of an export is read once uncompressed, so a
+// decompression bomb can't exhaust memory or keep a worker busy.
+type ExportLimits struct {
+	// Chat caps the chat text
+	Chat int64
+	// Media caps all attachments together; the ones past it are skipped
+	Media int64
+	// Files caps the number of entries in a zip
+	Files int
+}
+
+// chatFileR matches the chat inside a zip: "_chat.txt" on iOS and
+// "WhatsApp Chat with Ann.txt" on Android.
+var chatFileR = regexp.MustCompile(`(?i)^(?:_chat|WhatsApp Chat with .*)\.txt$`)
+
+// ReadZipExport reads a zipped WhatsApp export of size bytes. The chat can
+// be anywhere in the archive; if no entry is named like one the first .txt
+// is taken. Every other entry is an attachment, which is streamed to learn
+// its real size and type and then thrown away. Attachments stop being read
+// once limits.Media is used up, see Export.AttachmentsPartial; only a chat
+// over limits.Chat or more than limits.Files entries fail the export.
+func ReadZipExport(r io.ReaderAt, size int64, limits ExportLimits) (Export, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Export{}, fmt.Errorf("failed to open zip: %w", err)
+	}
+	if len(zr.File) > limits.Files {
+		return Export{}, ErrExportTooLarge
+	}
+
+	var chat *zip.File
+	for _, zf := range zr.File {
+		if chatFileR.MatchString(path.Base(zf.Name)) {
+			chat = zf
+			break
+		}
+	}
+	for _, zf := range zr.File {
+		if chat == nil && strings.HasSuffix(strings.ToLower(zf.Name), ".txt") {
+			chat = zf
+		}
+	}
+	if chat == nil {
+		return Export{}, ErrNoChatInZip
+	}
+	if chat.UncompressedSize64 > uint64(limits.Chat) {
+		return Export{}, ErrExportTooLarge
+	}
+
+	rc, err := chat.Open()
+	if err != nil {
+		return Export{}, fmt.Errorf("failed to open %s: %w", chat.Name, err)
+	}
+	defer rc.Close()
+
+	body, err := io.ReadAll(&io.LimitedReader{R: rc, N: limits.Chat})
+	if err != nil {
+		return Export{}, fmt.Errorf("failed to read %s: %w", chat.Name, err)
+	}
+
+	exp := Export{".txt", string(body), []Attachment{}, false}
+	budget := limits.Media
+	for _, zf := range zr.File {
+		// macOS adds resource forks when zipping by hand
+		if zf == chat || zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") {
+			continue
+		}
+
+		a, err := readAttachment(zf, budget)
+		if errors.Is(err, errMediaBudget) {
+			exp.AttachmentsPartial = true
+			break
+		}
+		if err != nil {
+			return Export{}, err
+		}
+		budget -= a.Size
+		exp.Attachments = append(exp.Attachments, a)
+	}
+	return exp, nil
+}
+
+// readAttachment streams zf, reading at most budget bytes. The declared
+// size isn't trusted since it is whatever the zip says.
+func readAttachment(zf *zip.File, budget int64) (Attachment, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to open %s: %w", zf.Name, err)
+	}
+	defer rc.Close()
+
+	lr := &io.LimitedReader{R: rc, N: budget + 1}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(lr, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Attachment{}, fmt.Errorf("failed to read %s: %w", zf.Name, err)
+	}
+	rest, err := io.Copy(io.Discard, lr)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read %s: %w", zf.Name, err)
+	}
+
+	read := int64(n) + rest
+	if read > budget {
+		return Attachment{}, errMediaBudget
+	}
+
+	name := path.Base(zf.Name)
+	return Attachment{name, read, contentType(name, head[:n])}, nil
+}
+
+// ReadExport reads an export file for the parsers, see Export.
+func ReadExport(filename string, data []byte, limits ExportLimits) (Export, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	switch ext {
+	case ".txt", ".json":
+		if int64(len(data)) > limits.Chat {
+			return Export{}, ErrExportTooLarge
+		}
+		return Export{ext, string(data), nil, false}, nil
+	case ".zip":
+		return ReadZipExport(bytes.NewReader(data), int64(len(data)), limits)
+	default:
+		return Export{}, ErrUnknownFormat
+	}
+}
+
+// ParseOptions tune how ParseExport reads an export. The zero value infers
+// the date order and reads timestamps as UTC.
+type ParseOptions struct {
+	// Location is the zone the export was written in
+	Location *time.Location
+	// DateOrder overrides the inferred order of WhatsApp dates
+	DateOrder DateOrder
+}
+
+// ParseExport runs the parser matching exp.Ext and links the messages to
+// the attachments they name.
+func ParseExport(exp Export, opts ParseOptions) ([]Message, error) {
+	var (
+		messages []Message
+		err      error
+	)
+	if exp.Ext == ".json" {
+		messages, err = GetRawLinesTelegram(exp.Text)
+	} else {
+		messages, err = GetRawLinesOrder(exp.Text, opts.DateOrder)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	Localize(messages, loc)
+	linkAttachments(messages, exp.Attachments)
+	return messages, nil
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GraphNode is a member of the interaction graph. Partners is the number of
+// people they exchanged replies with, Strength the weight of all their
+// edges in both directions.
+type GraphNode struct {
+	ID       string `json:"id"`
+	Messages int    `json:"messages"`
+	Partners int    `json:"partners"`
+	Strength int    `json:"strength"`
+}
+
+// GraphEdge counts how often From answered To within a conversation.
+type GraphEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Weight int    `json:"weight"`
+}
+
+// GraphPair is two members and how often each answered the other.
+type GraphPair struct {
+	PersonOne string `json:"personOne"`
+	PersonTwo string `json:"personTwo"`
+	OneToTwo  int    `json:"oneToTwo"`
+	TwoToOne  int    `json:"twoToOne"`
+}
+
+// InteractionGraph is who replies to whom, as nodes and directed weighted
+// edges, plus what stands out in it.
+type InteractionGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+	// MostReciprocal answer each other the most, counting the quieter
+	// direction
+	MostReciprocal *GraphPair `json:"mostReciprocal"`
+	// OneSided are pairs where PersonOne does most of the answering
+	OneSided []GraphPair `json:"oneSided"`
+	// MostCentral is the member with the highest strength
+	MostCentral string `json:"mostCentral"`
+}
+
+// A pair is one-sided if it exchanged at least minOneSidedReplies replies
+// and one of them sent oneSidedRatio times as many as the other.
+const (
+	minOneSidedReplies = 6
+	oneSidedRatio      = 3
+)
+
+// interactionGraph builds the graph from the replies within a
+// conversation. senders are the nodes, so people nobody answered are kept.
+func interactionGraph(db *sql.DB, senders []MessagePerPerson) (InteractionGraph, error) {
+	rows, err := db.Query(`SELECT replier, replied_to, count(*)
+		FROM replies
+		WHERE same_conversation
+		GROUP BY replier, replied_to
+		ORDER BY replier, replied_to;`)
+	if err != nil {
+		return InteractionGraph{}, fmt.Errorf("failed to create interaction graph query: %w", err)
+	}
+	defer rows.Close()
+
+	g := InteractionGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}, OneSided: []GraphPair{}}
+	weights := make(map[[2]string]int)
+	for rows.Next() {
+		var e GraphEdge
+		if err := rows.Scan(&e.From, &e.To, &e.Weight); err != nil {
+			return InteractionGraph{}, fmt.Errorf("failed to scan interaction graph: %w", err)
+		}
+		e.From = strings.Replace(e.From, "- ", "", 1)
+		e.To = strings.Replace(e.To, "- ", "", 1)
+		g.Edges = append(g.Edges, e)
+		weights[[2]string{e.From, e.To}] = e.Weight
+	}
+
+	if err := rows.Err(); err != nil {
+		return InteractionGraph{}, fmt.Errorf("iteration error for interaction graph: %w", err)
+	}
+
+	var central GraphNode
+	for _, s := range senders {
+		node := GraphNode{ID: s.Sender, Messages: s.Count}
+		for _, other := range senders {
+			out, in := weights[[2]string{s.Sender, other.Sender}], weights[[2]string{other.Sender, s.Sender}]
+			if out+in > 0 {
+				node.Partners++
+				node.Strength += out + in
+			}
+		}
+		g.Nodes = append(g.Nodes, node)
+
+		// senders are sorted by messages, which breaks ties
+		if node.Strength > central.Strength {
+			central = node
+		}
+	}
+	g.MostCentral = central.ID
+
+	// every unordered pair once, in the order of senders
+	for i, a := range senders {
+		for _, b := range senders[i+1:] {
+			p := GraphPair{a.Sender, b.Sender, weights[[2]string{a.Sender, b.Sender}], weights[[2]string{b.Sender, a.Sender}]}
+			if p.TwoToOne > p.OneToTwo {
+				p = GraphPair{p.PersonTwo, p.PersonOne, p.TwoToOne, p.OneToTwo}
+			}
+
+			if p.TwoToOne > 0 && (g.MostReciprocal == nil || moreReciprocal(p, *g.MostReciprocal)) {
+				g.MostReciprocal = &p
+			}
+			if p.OneToTwo+p.TwoToOne >= minOneSidedReplies && p.OneToTwo >= oneSidedRatio*p.TwoToOne {
+				g.OneSided = append(g.OneSided, p)
+			}
+		}
+	}
+	slices.SortStableFunc(g.OneSided, func(x, y GraphPair) int {
+		return cmp.Compare(y.OneToTwo+y.TwoToOne, x.OneToTwo+x.TwoToOne)
+	})
+
+	return g, nil
+}
+
+// moreReciprocal compares pairs by their quieter direction, then by their
+// total.
+func moreReciprocal(p, than GraphPair) bool {
+	return cmp.Or(
+		cmp.Compare(min(p.OneToTwo, p.TwoToOne), min(than.OneToTwo, than.TwoToOne)),
+		cmp.Compare(p.OneToTwo+p.TwoToOne, than.OneToTwo+than.TwoToOne),
+	) > 0
+}
@@ -0,0 +1,278 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Membership actions. For ActionCreated and ActionRenamed the subject is
+// the group name rather than a person.
+const (
+	ActionCreated = "created"
+	ActionAdded   = "added"
+	ActionJoined  = "joined"
+	ActionLeft    = "left"
+	ActionRemoved = "removed"
+	ActionRenamed = "renamed"
+	ActionIcon    = "icon"
+)
+
+// MembershipEvent is a system line about who is in the group: Actor added
+// Subject, Subject left and so on. The exporting user shows up as "You".
+type MembershipEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Subject   string    `json:"subject"`
+}
+
+type GroupName struct {
+	Timestamp time.Time `json:"timestamp"`
+	By        string    `json:"by"`
+	Name      string    `json:"name"`
+}
+
+type TopAdder struct {
+	Person string `json:"person"`
+	Count  int    `json:"count"`
+}
+
+// Membership is the group's membership history within the analysed range.
+type Membership struct {
+	Events   []MembershipEvent `json:"events"`
+	TopAdder *TopAdder         `json:"topAdder"`
+	// Names starts with the name the group was created with, if known
+	Names          []GroupName `json:"names"`
+	CurrentMembers []string    `json:"currentMembers"`
+	FormerMembers  []string    `json:"formerMembers"`
+}
+
+// The English system lines of WhatsApp, plus the ones the Telegram parser
+// writes for service messages. The first group is always the actor. Only
+// English is recognised: system lines in other languages still stay out of
+// `chat` (see phrases.csv) but don't make it into Membership.
+var (
+	createdR = regexp.MustCompile(`^(.+?) created (?:this )?group ["“]?(.*?)["”]?$`)
+	addedR   = regexp.MustCompile(`^(.+?) added (.+?)(?:\. Tap to change who can add other members\.)?$`)
+	joinedR  = regexp.MustCompile(`^(.+?) joined(?: using this group's invite link| from the community)?$`)
+	leftR    = regexp.MustCompile(`^(.+?) left$`)
+	removedR = regexp.MustCompile(`^(.+?) removed (.+)$`)
+	renamedR = regexp.MustCompile(`^(.+?) changed the (?:group name|subject) (?:from .+ )?to ["“](.*)["”]$`)
+	iconR    = regexp.MustCompile(`^(.+?) (?:changed|deleted) (?:this group's|the group) icon$`)
+)
+
+// parseMembership extracts the events of a single message. Only lines
+// WhatsApp or Telegram wrote themselves are looked at: KindSystem lines,
+// which have no sender on Android and are service messages on Telegram, and
+// on iOS notices sent by one of groupSenders. iOS files the other events
+// under the member concerned ("Ann: You added Ann"), so any other KindNotice
+// line only counts if its sender is the actor or the subject, which keeps
+// "You received a view once photo. For added privacy" out. Typed text such
+// as "Ivan left" is never looked at.
+func parseMembership(m Message, groupSenders map[string]bool) []MembershipEvent {
+	switch {
+	case m.Kind == KindSystem:
+		return membershipText(m)
+	case m.Kind == KindNotice:
+		events := membershipText(m)
+		if groupSenders[m.Sender] {
+			return events
+		}
+		for _, e := range events {
+			if e.Actor == m.Sender || e.Subject == m.Sender {
+				return events
+			}
+		}
+	}
+	return nil
+}
+
+// membershipText matches the text of m against the system line patterns.
+func membershipText(m Message) []MembershipEvent {
+	event := func(action, actor, subject string) MembershipEvent {
+		return MembershipEvent{m.Timestamp, action, normalizeYou(actor), normalizeYou(subject)}
+	}
+
+	text := strings.TrimSpace(m.Text)
+	if g := createdR.FindStringSubmatch(text); g != nil {
+		return []MembershipEvent{event(ActionCreated, g[1], g[2])}
+	}
+	if g := renamedR.FindStringSubmatch(text); g != nil {
+		return []MembershipEvent{event(ActionRenamed, g[1], g[2])}
+	}
+	if g := iconR.FindStringSubmatch(text); g != nil {
+		return []MembershipEvent{event(ActionIcon, g[1], "")}
+	}
+	if g := joinedR.FindStringSubmatch(text); g != nil {
+		return []MembershipEvent{event(ActionJoined, g[1], g[1])}
+	}
+	if g := leftR.FindStringSubmatch(text); g != nil {
+		return []MembershipEvent{event(ActionLeft, g[1], g[1])}
+	}
+
+	action, g := ActionAdded, addedR.FindStringSubmatch(text)
+	if g == nil {
+		action, g = ActionRemoved, removedR.FindStringSubmatch(text)
+	}
+	if g == nil {
+		return nil
+	}
+
+	var ret []MembershipEvent
+	for _, subject := range splitNames(g[2]) {
+		ret = append(ret, event(action, g[1], subject))
+	}
+	return ret
+}
+
+// splitNames splits "Ann, Bob and Cy" into its names.
+func splitNames(s string) []string {
+	var ret []string
+	for _, part := range strings.Split(strings.ReplaceAll(s, " and ", ", "), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+func normalizeYou(s string) string {
+	if strings.EqualFold(s, "you") {
+		return "You"
+	}
+	return s
+}
+
+// membershipEvents returns the events of every message keyed by msg_id,
+// i.e. the message's index.
+func membershipEvents(messages []Message) map[int][]MembershipEvent {
+	// on iOS the group itself "sends" the creation line, and then things
+	// like icon changes. Telegram service messages are KindSystem with the
+	// creator as sender, so they don't make the creator's typing count.
+	groupSenders := make(map[string]bool)
+	for _, m := range messages {
+		if m.Kind == KindNotice && m.Sender != "" && createdR.MatchString(m.Text) && strings.Contains(m.Text, m.Sender) {
+			groupSenders[m.Sender] = true
+		}
+	}
+
+	ret := make(map[int][]MembershipEvent)
+	for i, m := range messages {
+		if events := parseMembership(m, groupSenders); len(events) > 0 {
+			ret[i] = events
+		}
+	}
+	return ret
+}
+
+// loadMembership fills `membership_raw`, which prep.sql uses to keep these
+// lines out of `chat` and to build `membership_events`.
+func loadMembership(db *sql.DB, messages []Message) error {
+	if _, err := db.Exec(`CREATE OR REPLACE TABLE membership_raw (
+		msg_id          INTEGER,
+		event_timestamp TIMESTAMP,
+		action          VARCHAR,
+		actor           VARCHAR,
+		subject         VARCHAR
+	)`); err != nil {
+		return fmt.Errorf("failed to create membership_raw table: %w", err)
+	}
+
+	stmt, err := db.Prepare("INSERT INTO membership_raw VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to set up membership_raw insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for id, events := range membershipEvents(messages) {
+		for _, e := range events {
+			if _, err := stmt.Exec(id, wallClock(e.Timestamp), e.Action, e.Actor, e.Subject); err != nil {
+				return fmt.Errorf("failed to insert membership event: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// getMembership reads `membership_events` and works out who is still in
+// the group: everyone who wrote or was added, minus whoever's last event
+// was leaving or being removed. "You" is left out of both lists: the
+// exporter writes under their own name, which the export never ties to
+// "You", so counting both would list them twice.
+func getMembership(db *sql.DB, senders []MessagePerPerson) (Membership, error) {
+	rows, err := db.Query(`SELECT rawest.msg_utc, event_timestamp, action, actor, subject
+		FROM membership_events
+		JOIN rawest USING (msg_id)
+		ORDER BY rawest.msg_utc, msg_id, subject;`)
+	if err != nil {
+		return Membership{}, fmt.Errorf("failed to create membership query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := Membership{Events: []MembershipEvent{}, Names: []GroupName{}}
+	for rows.Next() {
+		var (
+			e         MembershipEvent
+			utc, wall time.Time
+		)
+		if err := rows.Scan(&utc, &wall, &e.Action, &e.Actor, &e.Subject); err != nil {
+			return Membership{}, fmt.Errorf("failed to scan membership event: %w", err)
+		}
+		e.Timestamp = withOffset(utc, wall)
+		ret.Events = append(ret.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return Membership{}, fmt.Errorf("iteration error for membership events: %w", err)
+	}
+
+	var adder TopAdder
+	err = db.QueryRow(`SELECT actor, count(*) AS added
+		FROM membership_events
+		WHERE action = 'added'
+		GROUP BY actor
+		ORDER BY added DESC, actor
+		LIMIT 1;`).Scan(&adder.Person, &adder.Count)
+	if err != nil && err != sql.ErrNoRows {
+		return Membership{}, fmt.Errorf("failed to find top adder: %w", err)
+	}
+	if err == nil {
+		ret.TopAdder = &adder
+	}
+
+	// a person's latest event decides whether they are still around
+	inGroup := make(map[string]bool)
+	for _, s := range senders {
+		inGroup[s.Sender] = true
+	}
+	for _, e := range ret.Events {
+		switch e.Action {
+		case ActionCreated, ActionRenamed:
+			ret.Names = append(ret.Names, GroupName{e.Timestamp, e.Actor, e.Subject})
+		case ActionAdded, ActionJoined:
+			if e.Subject != "You" {
+				inGroup[e.Subject] = true
+			}
+		case ActionLeft, ActionRemoved:
+			if e.Subject != "You" {
+				inGroup[e.Subject] = false
+			}
+		}
+	}
+
+	ret.CurrentMembers, ret.FormerMembers = []string{}, []string{}
+	for person, current := range inGroup {
+		if current {
+			ret.CurrentMembers = append(ret.CurrentMembers, person)
+		} else {
+			ret.FormerMembers = append(ret.FormerMembers, person)
+		}
+	}
+	slices.Sort(ret.CurrentMembers)
+	slices.Sort(ret.FormerMembers)
+
+	return ret, nil
+}
@@ -2,110 +2,320 @@ package pkg
 
 import (
 	"database/sql"
+	"encoding/csv"
+	"fmt"
 	"regexp"
 	"strings"
+	"time"
 )
 
+// MessageKind classifies a parsed message. Parsers only set the kinds they
+// can tell structurally (Android system lines, iOS notices, Telegram media
+// and service messages); prep.sql still recognises WhatsApp placeholders
+// like "image omitted" from the text.
+type MessageKind string
+
+const (
+	KindText   MessageKind = "text"
+	KindSystem MessageKind = "system"
+	// KindNotice is a line WhatsApp wrote on a member's behalf rather than
+	// something they typed: iOS marks these with U+200E, as in
+	// "Ann: You added Ann" or "Ann: image omitted". Unlike KindSystem they
+	// stay in `chat`.
+	KindNotice  MessageKind = "notice"
+	KindImage   MessageKind = "image"
+	KindVideo   MessageKind = "video"
+	KindAudio   MessageKind = "audio"
+	KindSticker MessageKind = "sticker"
+)
+
+// Message is a single logical chat message as emitted by the parsers and
+// loaded by PrepDB. Multi-line messages are already joined with "\n".
+type Message struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Sender    string      `json:"sender"`
+	Text      string      `json:"text"`
+	Kind      MessageKind `json:"kind"`
+	// Attachment is the file the message carries, if the export has media
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
+
 // get first line
 // clean
 // if first line contains [], iphone, else android
 // parse iphone as you know
 // parse android (?):
 //   -- regex for timestamp
-//   -- remove system messages
+//   -- system messages become KindSystem
+
+var (
+	androidLineR = regexp.MustCompile(`^(\d.{2,99}?) - (.*)`)
+	iosLineR     = regexp.MustCompile(`^\[(\d.*?)\]\s*(.*)`)
+)
 
-func GetRawLines(content string) []string {
+// GetRawLines parses a WhatsApp .txt export, inferring the date order.
+func GetRawLines(content string) ([]Message, error) {
+	return GetRawLinesOrder(content, DateOrderAuto)
+}
+
+// GetRawLinesOrder parses a WhatsApp .txt export reading its dates in
+// order, or in the order InferDateOrder picks if it is DateOrderAuto. Empty
+// lines are kept as "" so that ErrBadTimestamp can report the line number
+// of the original file.
+func GetRawLinesOrder(content string, order DateOrder) ([]Message, error) {
 	raw := strings.Split(content, "\n")
 
-	cleaned := []string{}
-	for _, row := range raw {
+	cleaned := make([]string, len(raw))
+	first := ""
+	for i, row := range raw {
 		c := strings.TrimSpace(row)
-		c = strings.ReplaceAll(c, "\u200e", "")
 		c = strings.ReplaceAll(c, "\u202f", "")
+		// the mark in front of the text is how splitSender tells notices
+		// apart, every other one goes
+		before, after, notice := strings.Cut(c, ": \u200e")
+		c = strings.ReplaceAll(before, "\u200e", "")
+		if notice {
+			c += ": \u200e" + strings.ReplaceAll(after, "\u200e", "")
+		}
 
-		if len(c) == 0 {
-			continue
+		cleaned[i] = c
+		if first == "" {
+			first = c
 		}
+	}
 
-		cleaned = append(cleaned, c)
+	var (
+		messages []Message
+		err      error
+	)
+	switch {
+	case first == "":
+		return nil, ErrEmptyChat
+	case iosLineR.MatchString(first):
+		messages, err = GetRawLinesIOS(cleaned, order)
+	case androidLineR.MatchString(first):
+		messages, err = GetRawLinesAndroid(cleaned, order)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if strings.Contains(cleaned[0], "[") && strings.Contains(cleaned[0], "]") {
-		return GetRawLinesIOS(cleaned)
+	if len(messages) == 0 {
+		return nil, ErrEmptyChat
 	}
+	return messages, nil
+}
 
-	return GetRawLinesAndroid(cleaned)
+func GetRawLinesAndroid(raw []string, order DateOrder) ([]Message, error) {
+	return parseLines(raw, androidLineR, order)
 }
 
-func GetRawLinesAndroid(raw []string) []string {
-	var fileLines []string
+func GetRawLinesIOS(raw []string, order DateOrder) ([]Message, error) {
+	return parseLines(raw, iosLineR, order)
+}
 
-	mainLineR := regexp.MustCompile(`^(.{3,100}?) - (.*)`)
-	for _, row := range raw {
-		matches := mainLineR.FindStringSubmatch(row)
+// parseLines splits raw lines into messages using a header regex whose
+// first group is the timestamp and second group is "Sender: text". Lines
+// that don't match, or whose "timestamp" isn't a date at all, are
+// continuations of the previous message: "10 - 4 was the score" and
+// "[1] footnote" are text, not headers. A date that doesn't parse, like
+// 99/99/2025, is an ErrBadTimestamp.
+func parseLines(raw []string, header *regexp.Regexp, order DateOrder) ([]Message, error) {
+	if order == DateOrderAuto {
+		var timestamps []string
+		for _, row := range raw {
+			if matches := header.FindStringSubmatch(row); len(matches) > 1 && isTimestamp(matches[1]) {
+				timestamps = append(timestamps, matches[1])
+			}
+		}
 
-		// skip non-main lines
-		if len(matches) <= 1 {
-			fileLines = append(fileLines, row)
+		var err error
+		if order, err = InferDateOrder(timestamps); err != nil {
+			return nil, err
+		}
+	}
+
+	var messages []Message
+
+	for i, row := range raw {
+		if len(row) == 0 {
 			continue
 		}
 
-		// skip system messages
-		if !strings.Contains(matches[2], ":") {
+		matches := header.FindStringSubmatch(row)
+		if len(matches) <= 1 || !looksLikeDate(matches[1]) {
+			appendContinuation(messages, row)
 			continue
 		}
 
-		ts := strings.ReplaceAll(matches[1], " - ", "")
+		parsed, err := ParseFlexible(matches[1], order)
+		if err != nil {
+			// a broken very first header means this isn't an export at all
+			if len(messages) == 0 {
+				return nil, ErrUnknownFormat
+			}
+			return nil, ErrBadTimestamp{i + 1, matches[1], err}
+		}
+
+		messages = append(messages, splitSender(parsed, matches[2]))
+	}
 
-		parsed, err := ParseFlexible(ts)
-		Invariant(err == nil, "cant parse time", err, row)
+	return messages, nil
+}
 
-		out := parsed.Format("02.01.06, 15:04:05")
+// isTimestamp reports whether s parses as a timestamp in either date order.
+func isTimestamp(s string) bool {
+	if _, err := ParseFlexible(s, DayFirst); err == nil {
+		return true
+	}
+	_, err := ParseFlexible(s, MonthFirst)
+	return err == nil
+}
 
-		newRow := strings.ReplaceAll(row, matches[1], "["+out+"] ")
-		fileLines = append(fileLines, newRow)
+// splitSender splits "Sender: text" at the first ": ". Lines without a
+// separator are system messages (joins, group renames...), except for the
+// iOS "Sender:" form with an empty body.
+func splitSender(ts time.Time, rest string) Message {
+	if sender, text, ok := strings.Cut(rest, ": "); ok {
+		kind := KindText
+		if strings.HasPrefix(text, "\u200e") {
+			kind = KindNotice
+		}
+		return Message{ts, strings.TrimSpace(sender), strings.TrimSpace(strings.TrimPrefix(text, "\u200e")), kind, nil}
+	}
 
+	if strings.HasSuffix(rest, ":") {
+		return Message{ts, strings.TrimSpace(strings.TrimSuffix(rest, ":")), "", KindText, nil}
 	}
 
-	return fileLines
+	return Message{ts, "", rest, KindSystem, nil}
 }
 
-func GetRawLinesIOS(raw []string) []string {
-	var fileLines []string
-	r := regexp.MustCompile(`^\[(.+?)\]`)
-	for _, row := range raw {
-		ts := r.FindString(row)
-		tss := strings.Trim(ts, "[]")
-		if len(tss) == 0 {
-			fileLines = append(fileLines, row)
-			continue
+// appendContinuation glues a line without a timestamp onto the last
+// message. Lines before the first message are dropped.
+func appendContinuation(messages []Message, row string) {
+	if len(messages) == 0 {
+		return
+	}
+
+	last := &messages[len(messages)-1]
+	last.Text += "\n" + strings.ReplaceAll(row, "\u200e", "")
+}
+
+// PrepDB loads the parsed messages into DuckDB and builds `chat` and every
+// derived table. It returns ErrEmptyChat if nothing is left once system
+// messages are filtered out.
+func PrepDB(db *sql.DB, messages []Message) error {
+	return PrepDBRange(db, messages, DateRange{})
+}
+
+// PrepDBRange is PrepDB limited to the messages sent within r. Every table
+// derived from `chat` only sees those messages.
+func PrepDBRange(db *sql.DB, messages []Message, r DateRange) error {
+	_, err := db.Exec(`CREATE OR REPLACE TABLE rawest (
+		msg_id        INTEGER,
+		msg_timestamp TIMESTAMP,
+		msg_utc       TIMESTAMP,
+		msg_sender    VARCHAR,
+		msg_text      VARCHAR,
+		msg_kind        VARCHAR,
+		attachment_name VARCHAR,
+		attachment_size BIGINT,
+		attachment_type VARCHAR
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create rawest table: %w", err)
+	}
+
+	stmt, err := db.Prepare("INSERT INTO rawest VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to set up rawest insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// msg_id keeps the export order, which breaks ties between messages
+	// sent within the same second. msg_timestamp is the local wall clock for
+	// time of day stats, msg_utc the instant for measuring gaps, which stays
+	// right across DST changes.
+	for i, m := range messages {
+		text := strings.Trim(m.Text, "\r")
+		var name, typ, size any
+		if a := m.Attachment; a != nil {
+			name, size, typ = a.Name, a.Size, a.Type
 		}
+		if _, err := stmt.Exec(i, wallClock(m.Timestamp), m.Timestamp.UTC(), m.Sender, text, string(m.Kind), name, size, typ); err != nil {
+			return fmt.Errorf("failed to insert message into rawest: %w", err)
+		}
+	}
 
-		parsed, err := ParseFlexible(tss)
-		Invariant(err == nil, "cant parse time", err, row)
+	if err := loadPhrases(db); err != nil {
+		return err
+	}
+	if err := loadMembership(db, messages); err != nil {
+		return err
+	}
+
+	return PrepRange(db, r)
+}
+
+// loadPhrases loads PhrasesCSV into the `phrases` table prep.sql matches
+// system messages and media placeholders against.
+func loadPhrases(db *sql.DB) error {
+	rows, err := csv.NewReader(strings.NewReader(PhrasesCSV)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to read phrases: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE OR REPLACE TABLE phrases (
+		lang    VARCHAR,
+		kind    VARCHAR,
+		pattern VARCHAR
+	)`); err != nil {
+		return fmt.Errorf("failed to create phrases table: %w", err)
+	}
 
-		out := parsed.Format("02.01.06, 15:04:05")
-		row = strings.ReplaceAll(row, tss, out)
-		fileLines = append(fileLines, row)
+	stmt, err := db.Prepare("INSERT INTO phrases VALUES (?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to set up phrases insert statement: %w", err)
 	}
+	defer stmt.Close()
 
-	return fileLines
+	// the first row is the header
+	for _, row := range rows[1:] {
+		if _, err := stmt.Exec(row[0], row[1], row[2]); err != nil {
+			return fmt.Errorf("failed to insert phrase: %w", err)
+		}
+	}
+	return nil
 }
 
-func PrepDB(db *sql.DB, lines []string) {
-	_, err := db.Exec("CREATE OR REPLACE TABLE rawest (line VARCHAR)")
-	Invariant(err == nil, "failed to create rawest table", err)
+// PrepRange rebuilds `chat` and every derived table for r from the messages
+// already loaded by PrepDBRange, so another period of the same chat can be
+// analysed without parsing and inserting it again.
+func PrepRange(db *sql.DB, r DateRange) error {
+	if _, err := db.Exec(`CREATE OR REPLACE TABLE date_range (
+		range_from TIMESTAMP,
+		range_to   TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create date_range table: %w", err)
+	}
+	from, to := r.bounds()
+	if _, err := db.Exec("INSERT INTO date_range VALUES (?, ?)", from, to); err != nil {
+		return fmt.Errorf("failed to insert date range: %w", err)
+	}
 
-	stmt, err := db.Prepare("INSERT INTO rawest VALUES (?)")
-	Invariant(err == nil, "failed to set up rawest insert statement", err)
-	for _, line := range lines {
-		trimmed := strings.Trim(line, "\r")
-		_, err := stmt.Exec(trimmed)
-		Invariant(err == nil, "failed to insert line into rawest", trimmed, err)
+	if _, err := db.Exec(PrepQuery); err != nil {
+		return fmt.Errorf("failed to create chat tables: %w", err)
 	}
-	err = stmt.Close()
-	Invariant(err == nil, "failed to close insert rawest statement", err)
 
-	_, err = db.Exec(PrepQuery)
-	Invariant(err == nil, "failed to create raw table", err)
+	total, err := totalMessages(db)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return ErrEmptyChat
+	}
+	return nil
 }
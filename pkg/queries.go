@@ -14,6 +14,12 @@ import (
 //go:embed queries/prep.sql
 var PrepQuery string
 
+// PhrasesCSV lists localized system messages and media placeholders as
+// lang,kind,pattern rows. Patterns are matched with ILIKE.
+//
+//go:embed queries/phrases.csv
+var PhrasesCSV string
+
 //go:embed queries/top3emojis.sql
 var Top3EmojisQuery string
 
@@ -38,6 +44,18 @@ var BotQuery string
 //go:embed queries/opener.sql
 var OpenerQuery string
 
+//go:embed queries/silence.sql
+var SilenceQuery string
+
+//go:embed queries/ignored.sql
+var IgnoredQuery string
+
+//go:embed queries/activity.sql
+var ActivityQuery string
+
+//go:embed queries/dead_period.sql
+var DeadPeriodQuery string
+
 // totalMessages returns the total number of messages or an error.
 func totalMessages(db *sql.DB) (int, error) {
 	var total int
@@ -47,6 +65,24 @@ func totalMessages(db *sql.DB) (int, error) {
 	return total, nil
 }
 
+// chatSpan returns the timestamps of the first and last message that made
+// it into `chat`, i.e. the dates actually covered by the analysis. They
+// carry the export's UTC offset at the time.
+func chatSpan(db *sql.DB) (time.Time, time.Time, error) {
+	var firstUTC, firstWall, lastUTC, lastWall time.Time
+	err := db.QueryRow(`SELECT min(msg_utc), min_by(msg_timestamp, msg_utc), max(msg_utc), max_by(msg_timestamp, msg_utc)
+		FROM chat;`).Scan(&firstUTC, &firstWall, &lastUTC, &lastWall)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get chat span: %w", err)
+	}
+	return withOffset(firstUTC, firstWall), withOffset(lastUTC, lastWall), nil
+}
+
+// withOffset returns the instant utc in the zone whose wall clock read wall.
+func withOffset(utc, wall time.Time) time.Time {
+	return utc.In(time.FixedZone("", int(wall.Sub(utc).Seconds())))
+}
+
 // MessagePerPerson describes a sender and their message count.
 type MessagePerPerson struct {
 	Sender string `json:"sender"`
@@ -55,7 +91,7 @@ type MessagePerPerson struct {
 
 // messagesPerPerson returns a slice with message counts per sender or an error.
 func messagesPerPerson(db *sql.DB) ([]MessagePerPerson, error) {
-	rows, err := db.Query("SELECT msg_sender, count(*) AS message_count FROM chat GROUP BY msg_sender ORDER BY message_count DESC;")
+	rows, err := db.Query("SELECT msg_sender, count(*) AS message_count FROM chat GROUP BY msg_sender ORDER BY message_count DESC, msg_sender;")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create messages per person query: %w", err)
 	}
@@ -106,6 +142,32 @@ func topEmojis(db *sql.DB) ([]TopEmoji, error) {
 	return ret, nil
 }
 
+// emojiCounts returns how often every emoji was used or an error.
+func emojiCounts(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query("SELECT emoji, count(*) FROM emojis GROUP BY emoji;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emoji counts query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := make(map[string]int)
+	for rows.Next() {
+		var (
+			emoji string
+			count int
+		)
+		if err := rows.Scan(&emoji, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan emoji count: %w", err)
+		}
+		ret[emoji] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for emoji counts: %w", err)
+	}
+	return ret, nil
+}
+
 // MediaCount holds a sender and their media count.
 type MediaCount struct {
 	Sender string `json:"sender"`
@@ -114,7 +176,7 @@ type MediaCount struct {
 
 // mediaCounter returns counts of a given media type per sender or an error.
 func mediaCounter(db *sql.DB, media string) ([]MediaCount, error) {
-	rows, err := db.Query("SELECT msg_sender, count(*) AS cnt FROM " + media + " GROUP BY msg_sender ORDER BY cnt DESC;")
+	rows, err := db.Query("SELECT msg_sender, count(*) AS cnt FROM " + media + " GROUP BY msg_sender ORDER BY cnt DESC, msg_sender;")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create a media query (%s): %w", media, err)
 	}
@@ -0,0 +1,17 @@
+-- The longest run of consecutive active days for the group (msg_sender
+-- NULL) and for every sender, the earliest one on ties, next to how many
+-- days each of them wrote on
+SELECT
+    msg_sender,
+    active_days,
+    days,
+    start_day,
+    end_day
+FROM (
+    SELECT *,
+           sum(days) OVER (PARTITION BY msg_sender)                                  AS active_days,
+           row_number() OVER (PARTITION BY msg_sender ORDER BY days DESC, start_day) AS rank
+    FROM daily_runs
+)
+WHERE rank = 1
+ORDER BY msg_sender IS NOT NULL, days DESC, msg_sender;
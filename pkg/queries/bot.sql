@@ -1,14 +1,14 @@
-
 -- Average words per message for every user (sender)
 SELECT
     msg_sender,
     avg(len(regexp_split_to_array(msg_text, '\s+'))) AS avg_words_per_message
 FROM chat
-WHERE                 -- skip empty rows & attachment placeholders
+WHERE                 -- skip empty rows, notices, media & attachment placeholders
       msg_text IS NOT NULL
   AND msg_text <> ''
-  AND lower(msg_text) NOT LIKE '% omitted'
+  AND msg_kind = 'text'
+  AND NOT EXISTS (SELECT 1 FROM phrases WHERE kind <> 'system' AND msg_text ILIKE pattern)
 GROUP BY msg_sender
-ORDER BY avg_words_per_message ASC
+ORDER BY avg_words_per_message ASC, msg_sender
 LIMIT 1;   -- or ORDER BY msg_sender
                    -- remove LIMIT for a full list
@@ -14,7 +14,7 @@ SELECT
     COUNT(*) AS one_on_one_conversation_count
 FROM two_party_conv
 GROUP BY person1, person2
-ORDER BY one_on_one_conversation_count DESC
+ORDER BY one_on_one_conversation_count DESC, person1, person2
 LIMIT 1;                             -- top couple
 
 
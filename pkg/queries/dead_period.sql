@@ -0,0 +1,15 @@
+-- The longest run of days without a message between two of the group's
+-- active runs, the earliest one on ties
+SELECT
+    end_day + 1                      AS first_dead_day,
+    next_start - 1                   AS last_dead_day,
+    next_start - end_day - 1         AS dead_days
+FROM (
+    SELECT *,
+           LEAD(start_day) OVER (ORDER BY start_day) AS next_start
+    FROM daily_runs
+    WHERE msg_sender IS NULL
+)
+WHERE next_start IS NOT NULL
+ORDER BY dead_days DESC, start_day
+LIMIT 1;
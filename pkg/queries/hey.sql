@@ -30,5 +30,5 @@ SELECT
     ROUND(AVG(y_cnt), 2) AS avg_y_per_hey
 FROM y_counts
 GROUP BY msg_sender
-ORDER BY avg_y_per_hey DESC
+ORDER BY avg_y_per_hey DESC, msg_sender
 LIMIT 1;
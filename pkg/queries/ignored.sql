@@ -0,0 +1,28 @@
+-- Conversations every sender started, and how many of them nobody else
+-- joined before it went quiet
+WITH convs AS (
+    SELECT
+        conversation_id,
+        first(msg_sender ORDER BY msg_utc, msg_id) AS starter,
+        count(DISTINCT msg_sender)                 AS participants
+    FROM conversations
+    GROUP BY conversation_id
+),
+counts AS (
+    SELECT
+        starter,
+        count(*) FILTER (WHERE participants = 1) AS ignored,
+        count(*)                                 AS started
+    FROM convs
+    GROUP BY starter
+)
+
+-- ranked by the share ignored, so starting many chats isn't held against
+-- anyone; the busier starter wins ties
+SELECT
+    starter,
+    ignored,
+    started,
+    round(100.0 * ignored / started)::INTEGER AS percent
+FROM counts
+ORDER BY ignored / started DESC, started DESC, starter;
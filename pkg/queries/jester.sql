@@ -8,5 +8,5 @@ WHERE regexp_matches(
           '[😂😭💀]'            -- 🤣  Unicode literals work fine in DuckDB
       )
 GROUP BY msg_sender
-ORDER BY emoji_message_count DESC
+ORDER BY emoji_message_count DESC, msg_sender
 LIMIT 1;        
@@ -15,5 +15,5 @@ SELECT
     duration,
     participants                 -- e.g. ['Alice', 'Bob', 'Charlie']
 FROM conv_stats
-ORDER BY duration DESC
+ORDER BY duration DESC, conversation_id
 LIMIT 1;       
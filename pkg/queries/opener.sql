@@ -5,7 +5,7 @@ WITH conv_starters AS (
         conversation_id,
         FIRST_VALUE(msg_sender) OVER (
             PARTITION BY conversation_id
-            ORDER BY msg_timestamp
+            ORDER BY msg_timestamp, msg_id
         ) AS starter
     FROM conversations
     /* One row per conversation is enough, so use DISTINCT later */
@@ -20,5 +20,5 @@ FROM (
     FROM conv_starters
 ) t
 GROUP BY starter
-ORDER BY conversations_started DESC
+ORDER BY conversations_started DESC, starter
 LIMIT 1;          -- remove this LIMIT if you want every sender ranked
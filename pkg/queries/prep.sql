@@ -1,112 +1,118 @@
 
 --------------------------------------------------------------------
--- 0.  Load the plain-text dump (table `rawest` already exists)
---------------------------------------------------------------------
-CREATE OR REPLACE TABLE raw AS
-SELECT
-    trim(regexp_replace(line, '\x{200E}\x{00A0}\r', ' ', 'g')) AS line
-FROM rawest;
-
---------------------------------------------------------------------
--- 1.  Mark the lines that begin a new message
---------------------------------------------------------------------
-ALTER TABLE raw ADD COLUMN is_new BOOL;
-
-UPDATE raw
-SET    is_new = regexp_matches(
-           line,
-           '^\[([0-9]{1,2}\.[0-9]{1,2}\.[0-9]{1,2}, [0-9]{1,2}:[0-9]{1,2}:[0-9]{1,2})\]'
-       );
-
---------------------------------------------------------------------
--- 2.  Collapse physical lines into logical message lines
---------------------------------------------------------------------
-CREATE OR REPLACE TABLE msg_lines AS
-SELECT
-    *,
-    sum(CASE WHEN is_new THEN 1 ELSE 0 END) OVER (ORDER BY rowid) AS message_id
-FROM   raw
-ORDER  BY rowid;
-
---------------------------------------------------------------------
--- 3.  Re-assemble full messages
---------------------------------------------------------------------
-CREATE OR REPLACE TABLE messages AS
-SELECT
-    message_id,
-    string_agg(line, '\n' ORDER BY rowid) AS full_line
-FROM   msg_lines
-GROUP  BY message_id
-ORDER  BY message_id;
-
---------------------------------------------------------------------
--- 4.  Build `chat_raw` (= all messages, still including the system user)
+-- 0.  Build `chat_raw` (= all messages, still including the system user)
+--     from the typed rows PrepDB loaded into `rawest`
 --------------------------------------------------------------------
 CREATE OR REPLACE TEMP TABLE chat_raw AS
 SELECT
-    strptime(
-        regexp_extract(full_line,
-            '^\[([0-9]{1,2}\.[0-9]{1,2}\.[0-9]{1,2}, [0-9]{1,2}:[0-9]{1,2}:[0-9]{1,2})\]',
-            1),
-        '%d.%m.%y, %H:%M:%S'
-    )                                              AS msg_timestamp,
-    trim(regexp_extract(full_line, '\]\s*(.*?):', 1))    AS msg_sender,
-    trim(regexp_extract(full_line, '\]\s*.*?: (.*)$', 1)) AS msg_text
-FROM messages;
+    msg_id,
+    msg_timestamp,
+    msg_utc,
+    trim(msg_sender) AS msg_sender,
+    trim(msg_text)   AS msg_text,
+    msg_kind,
+    attachment_name,
+    attachment_size,
+    attachment_type
+FROM rawest;
 
 --------------------------------------------------------------------
--- 5.  Detect the WhatsApp “system” sender(s)
+-- 1.  Detect the WhatsApp “system” sender(s) in any language we have
+--     phrases for (PrepDB loads queries/phrases.csv into `phrases`)
 --------------------------------------------------------------------
 CREATE OR REPLACE TEMP TABLE system_senders AS
-WITH patterns(txt) AS (
-    VALUES
-      ('Messages and calls are end-to-end encrypted%'),
-      ('You created group%'),
-      ('You changed this group%')
-)
 SELECT DISTINCT msg_sender
-FROM   chat_raw, patterns
-WHERE  msg_text ILIKE txt;     -- ILIKE = case-insensitive LIKE
+FROM   chat_raw
+JOIN   phrases
+  ON   phrases.kind = 'system'
+ AND   msg_text ILIKE phrases.pattern;     -- ILIKE = case-insensitive LIKE
 
 --------------------------------------------------------------------
--- 6.  Final `chat` table  (system sender purged – all downstream SQL is safe)
+-- 2.  Final `chat` table  (system sender purged – all downstream SQL is safe)
 --------------------------------------------------------------------
 CREATE OR REPLACE TABLE chat AS
 SELECT *
 FROM   chat_raw
-WHERE  msg_sender NOT IN (SELECT msg_sender FROM system_senders);
+WHERE  msg_kind <> 'system'
+  AND  msg_sender NOT IN (SELECT msg_sender FROM system_senders)
+  AND  msg_id NOT IN (SELECT msg_id FROM membership_raw);  -- iOS "You added X"
+
+--------------------------------------------------------------------
+-- 2b. Keep only the requested date range  (NULL bounds are open, and a
+--     comparison with NULL never deletes anything)
+--------------------------------------------------------------------
+DELETE FROM chat
+WHERE  msg_timestamp <  (SELECT range_from FROM date_range)
+   OR  msg_timestamp >= (SELECT range_to   FROM date_range);
+
+-- joins, leaves, renames... parsed by PrepDB, within the same range
+CREATE OR REPLACE TABLE membership_events AS
+SELECT *
+FROM   membership_raw;
+
+DELETE FROM membership_events
+WHERE  event_timestamp <  (SELECT range_from FROM date_range)
+   OR  event_timestamp >= (SELECT range_to   FROM date_range);
 
 --------------------------------------------------------------------
--- 7.  Media-only helper tables (now fed by the cleaned-up `chat`)
+-- 3.  Media-only helper tables (now fed by the cleaned-up `chat`), by
+--     message kind, a localized placeholder such as "image omitted" or the
+--     attached file's name such as "IMG-20250427-WA0001.jpg"
 --------------------------------------------------------------------
 CREATE OR REPLACE TABLE images AS
-SELECT msg_sender
+SELECT msg_id, msg_sender
 FROM   chat
-WHERE  lower(msg_text) IN ('image omitted', 'images omitted');
+WHERE  msg_kind = 'image'
+   OR  EXISTS (SELECT 1 FROM phrases WHERE kind = 'image' AND msg_text ILIKE pattern);
 
 CREATE OR REPLACE TABLE videos AS
-SELECT msg_sender
+SELECT msg_id, msg_sender
 FROM   chat
-WHERE  lower(msg_text) IN ('video omitted', 'videos omitted');
+WHERE  msg_kind = 'video'
+   OR  EXISTS (SELECT 1 FROM phrases WHERE kind = 'video' AND msg_text ILIKE pattern);
 
 CREATE OR REPLACE TABLE audios AS
-SELECT msg_sender
+SELECT msg_id, msg_sender
 FROM   chat
-WHERE  lower(msg_text) IN ('audio omitted', 'audios omitted');
+WHERE  msg_kind = 'audio'
+   OR  EXISTS (SELECT 1 FROM phrases WHERE kind = 'audio' AND msg_text ILIKE pattern);
 
 CREATE OR REPLACE TABLE stickers AS
-SELECT msg_sender
+SELECT msg_id, msg_sender
 FROM   chat
-WHERE  lower(msg_text) IN ('sticker omitted', 'stickers omitted');
+WHERE  msg_kind = 'sticker'
+   OR  EXISTS (SELECT 1 FROM phrases WHERE kind = 'sticker' AND msg_text ILIKE pattern);
+
+-- every attachment: the typed tables above plus placeholders that don't
+-- say what was sent, like Android's "<Media omitted>"
+CREATE OR REPLACE TABLE media AS
+SELECT msg_id, msg_sender, 'image'   AS media_type FROM images
+UNION ALL
+SELECT msg_id, msg_sender, 'video'   AS media_type FROM videos
+UNION ALL
+SELECT msg_id, msg_sender, 'audio'   AS media_type FROM audios
+UNION ALL
+SELECT msg_id, msg_sender, 'sticker' AS media_type FROM stickers
+UNION ALL
+SELECT msg_id, msg_sender, 'unknown' AS media_type
+FROM   chat
+WHERE  EXISTS (SELECT 1 FROM phrases WHERE kind = 'media' AND msg_text ILIKE pattern)
+  AND  msg_id NOT IN (
+           SELECT msg_id FROM images
+           UNION ALL SELECT msg_id FROM videos
+           UNION ALL SELECT msg_id FROM audios
+           UNION ALL SELECT msg_id FROM stickers
+       );
 
 --------------------------------------------------------------------
--- 8.  Conversation segmentation (unchanged logic, but runs on clean `chat`)
+-- 4.  Conversation segmentation (unchanged logic, but runs on clean `chat`;
+--     gaps are measured on msg_utc so DST changes don't split or merge)
 --------------------------------------------------------------------
 CREATE OR REPLACE TABLE conversations AS
 WITH ordered AS (
     SELECT
         *,
-        LAG(msg_timestamp) OVER (ORDER BY msg_timestamp) AS prev_ts
+        LAG(msg_utc) OVER (ORDER BY msg_utc, msg_id) AS prev_ts
     FROM chat
 ),
 flags AS (
@@ -114,7 +120,7 @@ flags AS (
         *,
         CASE
             WHEN prev_ts IS NULL
-              OR msg_timestamp - prev_ts > INTERVAL '300 seconds'
+              OR msg_utc - prev_ts > INTERVAL '300 seconds'
             THEN 1
             ELSE 0
         END AS new_conv
@@ -122,7 +128,110 @@ flags AS (
 )
 SELECT
     *,
-    SUM(new_conv) OVER (ORDER BY msg_timestamp) AS conversation_id
+    SUM(new_conv) OVER (ORDER BY msg_utc, msg_id) AS conversation_id
 FROM flags
-ORDER BY msg_timestamp;
+ORDER BY msg_utc, msg_id;
 
+--------------------------------------------------------------------
+-- 4b. Replies: the first message of a sender after someone else wrote,
+--     timed from that last message by someone else. Replies that open a
+--     new conversation count too, so slow repliers show up as slow.
+--------------------------------------------------------------------
+CREATE OR REPLACE TABLE replies AS
+WITH ordered AS (
+    SELECT
+        msg_id,
+        msg_sender,
+        msg_utc,
+        conversation_id,
+        LAG(msg_sender)      OVER w AS prev_sender,
+        LAG(msg_utc)         OVER w AS prev_ts,
+        LAG(conversation_id) OVER w AS prev_conversation_id
+    FROM conversations
+    WINDOW w AS (ORDER BY msg_utc, msg_id)
+)
+SELECT
+    msg_id,
+    msg_sender                             AS replier,
+    prev_sender                            AS replied_to,
+    epoch(msg_utc - prev_ts)               AS latency_seconds,
+    conversation_id = prev_conversation_id AS same_conversation
+FROM ordered
+WHERE prev_sender IS NOT NULL
+  AND prev_sender <> msg_sender;
+
+--------------------------------------------------------------------
+-- 4c. Bursts: runs of back-to-back messages by the same sender. A run
+--     ends when someone else writes or the conversation ends.
+--------------------------------------------------------------------
+CREATE OR REPLACE TABLE bursts AS
+WITH ordered AS (
+    SELECT
+        *,
+        LAG(msg_sender)      OVER w AS prev_sender,
+        LAG(conversation_id) OVER w AS prev_conversation_id
+    FROM conversations
+    WINDOW w AS (ORDER BY msg_utc, msg_id)
+),
+runs AS (
+    SELECT
+        *,
+        SUM(CASE
+                WHEN prev_sender IS DISTINCT FROM msg_sender
+                  OR prev_conversation_id <> conversation_id
+                THEN 1
+                ELSE 0
+            END) OVER (ORDER BY msg_utc, msg_id) AS burst_id
+    FROM ordered
+)
+SELECT
+    burst_id,
+    any_value(msg_sender)              AS msg_sender,
+    count(*)                           AS messages,
+    min(msg_utc)                       AS start_utc,
+    min_by(msg_timestamp, msg_utc)     AS start_ts,
+    max(msg_utc)                       AS end_utc,
+    max_by(msg_timestamp, msg_utc)     AS end_ts
+FROM runs
+GROUP BY burst_id;
+
+--------------------------------------------------------------------
+-- 4d. Daily runs: consecutive calendar days with at least one message,
+--     for the whole group (msg_sender NULL) and for every sender
+--------------------------------------------------------------------
+CREATE OR REPLACE TABLE daily_runs AS
+WITH days AS (                            -- one row per active day and scope
+    SELECT DISTINCT NULL::VARCHAR AS msg_sender, msg_timestamp::DATE AS day
+    FROM chat
+    UNION ALL
+    SELECT DISTINCT msg_sender, msg_timestamp::DATE
+    FROM chat
+),
+runs AS (                                 -- constant inside each run of days
+    SELECT
+        *,
+        day - (row_number() OVER (PARTITION BY msg_sender ORDER BY day))::INTEGER AS run_id
+    FROM days
+)
+SELECT
+    msg_sender,
+    count(*) AS days,
+    min(day) AS start_day,
+    max(day) AS end_day
+FROM runs
+GROUP BY msg_sender, run_id;
+
+--------------------------------------------------------------------
+-- 5.  Emoji tokens, one row per emoji used (single‑line regex)
+--------------------------------------------------------------------
+CREATE OR REPLACE TABLE emojis AS
+SELECT
+    msg_sender,
+    emoji
+FROM chat
+     , LATERAL UNNEST(
+           regexp_extract_all(
+               msg_text,
+               '[\x{1F600}-\x{1F64F}\x{1F300}-\x{1F5FF}\x{1F680}-\x{1F6FF}\x{1F1E6}-\x{1F1FF}\x{2600}-\x{26FF}\x{2700}-\x{27BF}\x{1F900}-\x{1F9FF}\x{1FA70}-\x{1FAFF}]'
+           )
+     ) AS t(emoji);
@@ -0,0 +1,39 @@
+-- The longest silence in `chat`: the message before it ('ignored'), the
+-- reply that broke it ('reply') and up to three messages before
+-- ('context'), in chronological order
+WITH chat_rn AS (                         -- add a running row number
+    SELECT *,
+           row_number() OVER (ORDER BY msg_utc, msg_id) AS rn
+    FROM chat
+),
+
+gaps AS (                                 -- compute the gap to the very next post
+    SELECT rn,
+           LEAD(msg_utc) OVER (ORDER BY rn) - msg_utc AS gap
+    FROM chat_rn
+),
+
+longest AS (                              -- the single biggest gap that has a reply
+    SELECT rn, gap
+    FROM gaps
+    WHERE gap IS NOT NULL
+    ORDER BY gap DESC, rn
+    LIMIT 1
+)
+
+SELECT
+    c.msg_utc,
+    c.msg_timestamp,
+    c.msg_sender,
+    c.msg_text,
+    CASE c.rn - l.rn
+        WHEN 0 THEN 'ignored'
+        WHEN 1 THEN 'reply'
+        ELSE 'context'
+    END                     AS role,
+    epoch(l.gap)::BIGINT    AS gap_seconds
+FROM chat_rn AS c
+JOIN longest AS l
+  ON c.rn BETWEEN l.rn - 3   -- three earlier messages (may be fewer at file start)
+              AND l.rn + 1   -- the long-awaited reply (row right after the gap)
+ORDER BY c.rn;
@@ -10,7 +10,7 @@ WITH first_msgs AS (                         -- one row per conversation (its fi
             msg_sender,
             ROW_NUMBER() OVER (
                 PARTITION BY conversation_id
-                ORDER BY msg_timestamp
+                ORDER BY msg_timestamp, msg_id
             ) AS rn                              -- 1 = first message in that conversation
         FROM conversations
     )
@@ -22,5 +22,5 @@ SELECT
     COUNT(*)           AS conversations_started
 FROM first_msgs
 GROUP BY msg_sender
-ORDER BY conversations_started DESC
+ORDER BY conversations_started DESC, msg_sender
 LIMIT 1;                                      
@@ -0,0 +1,294 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type RedactCategory string
+
+const (
+	RedactPhone RedactCategory = "phone"
+	RedactEmail RedactCategory = "email"
+	RedactCard  RedactCategory = "card"
+)
+
+// AllRedactCategories is what gets redacted unless configured otherwise.
+var AllRedactCategories = []RedactCategory{RedactPhone, RedactEmail, RedactCard}
+
+// RedactionCounts is how many matches of each category were masked.
+type RedactionCounts map[RedactCategory]int
+
+var (
+	emailR = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// 13-19 digits, optionally grouped by spaces or dashes
+	cardR = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+	// an international number, an area code in parentheses, a national
+	// number with a trunk 0 or the US 3-3-4 grouping. Bare digit runs such
+	// as amounts, ids and year ranges are left alone, and so are dots so
+	// dates like 06.08.2024 don't match.
+	phoneR = regexp.MustCompile(`\+\d[\d \-()]{6,}\d|\(\d{2,5}\)[ \-]?\d{3,4}[ \-]?\d{3,4}\b|\b0\d{2,4}[ \-]?\d{3}[ \-]?\d{3,4}\b|\b\d{3}-\d{3}-\d{4}\b`)
+	// WhatsApp wraps numbers in directional marks
+	bidiMarks = "\u202a\u202c\u200e\u200f "
+	// a phone number together with the marks around it
+	markedPhoneR = regexp.MustCompile(`\x{202a}?(?:` + phoneR.String() + `)\x{202c}?`)
+)
+
+// ParseRedactCategories parses a comma separated list such as
+// "phone,email". "none" disables redaction and "" means every category.
+func ParseRedactCategories(s string) ([]RedactCategory, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return AllRedactCategories, nil
+	case "none":
+		return []RedactCategory{}, nil
+	}
+
+	var ret []RedactCategory
+	for _, part := range strings.Split(s, ",") {
+		c := RedactCategory(strings.ToLower(strings.TrimSpace(part)))
+		switch c {
+		case RedactPhone, RedactEmail, RedactCard:
+			ret = append(ret, c)
+		default:
+			return nil, fmt.Errorf("unknown redaction category %q", part)
+		}
+	}
+	return ret, nil
+}
+
+// Redactor masks personal data in chat text.
+type Redactor struct {
+	categories map[RedactCategory]bool
+}
+
+func NewRedactor(categories []RedactCategory) *Redactor {
+	r := &Redactor{make(map[RedactCategory]bool)}
+	for _, c := range categories {
+		r.categories[c] = true
+	}
+	return r
+}
+
+// Redact masks every enabled category in s. Cards go before phones since a
+// card number would also pass as a phone number. Phone numbers in text keep
+// their last four digits; senders go through pseudonyms instead.
+func (r *Redactor) Redact(s string, counts RedactionCounts) string {
+	if r.categories[RedactEmail] {
+		s = emailR.ReplaceAllStringFunc(s, func(string) string {
+			counts[RedactEmail]++
+			return "[email]"
+		})
+	}
+
+	if r.categories[RedactCard] {
+		s = cardR.ReplaceAllStringFunc(s, func(m string) string {
+			if !luhn(m) {
+				return m
+			}
+			counts[RedactCard]++
+			return "[card]"
+		})
+	}
+
+	if r.categories[RedactPhone] {
+		s = phoneR.ReplaceAllStringFunc(s, func(m string) string {
+			if !isPhoneNumber(m) {
+				return m
+			}
+			counts[RedactPhone]++
+			return maskDigits(m, 4)
+		})
+	}
+
+	return s
+}
+
+func isPhoneNumber(s string) bool {
+	digits := countDigits(s)
+	return digits >= 8 && digits <= 15
+}
+
+// pseudonyms hands out "Phone 1", "Phone 2"... to the numbers senders show
+// up as when they aren't in the exporter's contacts. Masking their digits
+// isn't enough: two numbers ending in the same four digits would become the
+// same person.
+type pseudonyms map[string]string
+
+// sender returns the pseudonym for sender if it is a bare phone number, and
+// sender itself otherwise.
+func (p pseudonyms) sender(sender string, counts RedactionCounts) string {
+	number := strings.Trim(sender, bidiMarks)
+	if loc := phoneR.FindStringIndex(number); loc == nil || loc[0] != 0 || loc[1] != len(number) || !isPhoneNumber(number) {
+		return sender
+	}
+
+	// the same number may be written with different spacing
+	key := strings.Map(func(c rune) rune {
+		if c >= '0' && c <= '9' {
+			return c
+		}
+		return -1
+	}, number)
+
+	name, ok := p[key]
+	if !ok {
+		name = fmt.Sprintf("Phone %d", len(p)+1)
+		p[key] = name
+	}
+	counts[RedactPhone]++
+	return name
+}
+
+// text gives the phone numbers in a line WhatsApp or Telegram wrote, such
+// as "Ann added +44 7700 900234", the pseudonyms the same numbers get as
+// senders, so Membership lists each of them once.
+func (p pseudonyms) text(s string, counts RedactionCounts) string {
+	return markedPhoneR.ReplaceAllStringFunc(s, func(m string) string {
+		return p.sender(m, counts)
+	})
+}
+
+// RedactMessages masks senders and texts of the parsed messages in place.
+func (r *Redactor) RedactMessages(messages []Message) RedactionCounts {
+	counts := RedactionCounts{}
+	names := pseudonyms{}
+	for i := range messages {
+		if r.categories[RedactPhone] {
+			messages[i].Sender = names.sender(messages[i].Sender, counts)
+			if k := messages[i].Kind; k == KindSystem || k == KindNotice {
+				messages[i].Text = names.text(messages[i].Text, counts)
+			}
+		}
+		messages[i].Sender = r.Redact(messages[i].Sender, counts)
+		messages[i].Text = r.Redact(messages[i].Text, counts)
+	}
+	return counts
+}
+
+// RedactExport masks an export before it is archived, keeping its format
+// intact so it can still be parsed later: WhatsApp timestamps are left
+// alone and Telegram exports stay valid JSON.
+func (r *Redactor) RedactExport(content string) string {
+	counts := RedactionCounts{}
+	names := pseudonyms{}
+
+	if strings.HasPrefix(strings.TrimSpace(content), "{") {
+		var export any
+		if err := json.Unmarshal([]byte(content), &export); err == nil {
+			if out, err := json.Marshal(r.redactJSON("", export, names, counts)); err == nil {
+				return string(out)
+			}
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		// never touch the timestamp, it would look like a phone number
+		skip := len(line) - len(strings.TrimLeft(line, "\ufeff\u200e "))
+		start := 0
+		for _, header := range []*regexp.Regexp{iosLineR, androidLineR} {
+			if loc := header.FindStringSubmatchIndex(line[skip:]); loc != nil {
+				start = skip + loc[4]
+				break
+			}
+		}
+		rest := line[start:]
+		if start > 0 && r.categories[RedactPhone] {
+			sender, text, ok := strings.Cut(rest, ": ")
+			switch {
+			case !ok:
+				rest = names.text(rest, counts)
+			case strings.HasPrefix(text, "\u200e"):
+				rest = names.sender(sender, counts) + ": " + names.text(text, counts)
+			default:
+				rest = names.sender(sender, counts) + ": " + text
+			}
+		}
+		lines[i] = line[:start] + r.Redact(rest, counts)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// telegramPlainFields hold dates and enums rather than user text.
+var telegramPlainFields = map[string]bool{
+	"date": true, "date_unixtime": true, "edited": true, "edited_unixtime": true,
+	"type": true, "media_type": true, "mime_type": true, "action": true,
+}
+
+func (r *Redactor) redactJSON(key string, v any, names pseudonyms, counts RedactionCounts) any {
+	switch t := v.(type) {
+	case string:
+		if telegramPlainFields[key] {
+			return t
+		}
+		if (key == "from" || key == "actor" || key == "members") && r.categories[RedactPhone] {
+			t = names.sender(t, counts)
+		}
+		return r.Redact(t, counts)
+	case []any:
+		for i := range t {
+			t[i] = r.redactJSON(key, t[i], names, counts)
+		}
+		return t
+	case map[string]any:
+		for k := range t {
+			t[k] = r.redactJSON(k, t[k], names, counts)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// maskDigits replaces every digit but the last `keep` ones with "•",
+// leaving separators in place: "+7 985 026-02-62" -> "+• ••• •••-02-62".
+func maskDigits(s string, keep int) string {
+	toMask := countDigits(s) - keep
+
+	var sb strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' && toMask > 0 {
+			sb.WriteRune('•')
+			toMask--
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func luhn(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
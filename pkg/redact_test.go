@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r := NewRedactor(AllRedactCategories)
+
+	for _, tc := range []struct {
+		in, want string
+		category RedactCategory
+	}{
+		{"write to ivan.petrov+wrapped@example.co.uk", "write to [email]", RedactEmail},
+		{"card 4111 1111 1111 1111 thanks", "card [card] thanks", RedactCard},
+		{"card 4111-1111-1111-1111", "card [card]", RedactCard},
+		{"call +7 985 026-02-62", "call +• ••• •••-02-62", RedactPhone},
+		{"call +359888123456", "call +••••••••3456", RedactPhone},
+		{"office (02) 987 6543", "office (••) ••• 6543", RedactPhone},
+		{"mobile 0888 123 456", "mobile •••• ••3 456", RedactPhone},
+		{"US 555-123-4567", "US •••-•••-4567", RedactPhone},
+	} {
+		counts := RedactionCounts{}
+		if got := r.Redact(tc.in, counts); got != tc.want {
+			t.Errorf("Redact(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+		if counts[tc.category] != 1 {
+			t.Errorf("Redact(%q) counted %v, want one %s", tc.in, counts, tc.category)
+		}
+	}
+}
+
+func TestRedactFalsePositives(t *testing.T) {
+	r := NewRedactor(AllRedactCategories)
+
+	for _, in := range []string{
+		"the flat was 12 345 678 in the end",
+		"season 2023-2024 2025 was the best",
+		"order id 123456789012",
+		"see you on 06.08.2024 at 18:30",
+		"22/05/2025 - 23/05/2025",
+		// fails the Luhn check
+		"4111 1111 1111 1112",
+		"not@an-email",
+	} {
+		counts := RedactionCounts{}
+		if got := r.Redact(in, counts); got != in {
+			t.Errorf("Redact(%q) = %q, want it unchanged", in, got)
+		}
+		if len(counts) != 0 {
+			t.Errorf("Redact(%q) counted %v", in, counts)
+		}
+	}
+}
+
+func TestRedactCategories(t *testing.T) {
+	r := NewRedactor([]RedactCategory{RedactEmail})
+
+	in := "mail me@example.com or call +359 888 123 456"
+	want := "mail [email] or call +359 888 123 456"
+	if got := r.Redact(in, RedactionCounts{}); got != want {
+		t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+	}
+
+	if _, err := ParseRedactCategories("phone,fax"); err == nil {
+		t.Error("ParseRedactCategories accepted an unknown category")
+	}
+	if got, _ := ParseRedactCategories("none"); len(got) != 0 {
+		t.Errorf("ParseRedactCategories(none) = %v", got)
+	}
+}
+
+func TestRedactSenderPseudonyms(t *testing.T) {
+	r := NewRedactor(AllRedactCategories)
+
+	messages := []Message{
+		{Sender: "\u202a+359 888 111 234\u202c", Text: "hi"},
+		{Sender: "+44 7700 900234", Text: "same last four digits"},
+		{Sender: "+359888111234", Text: "the first number again"},
+		{Sender: "Ivan", Text: "my number is +359 888 111 234"},
+	}
+	counts := r.RedactMessages(messages)
+
+	var senders []string
+	for _, m := range messages {
+		senders = append(senders, m.Sender)
+	}
+	if got, want := strings.Join(senders, ","), "Phone 1,Phone 2,Phone 1,Ivan"; got != want {
+		t.Errorf("senders = %s, want %s", got, want)
+	}
+	if want := "my number is +••• ••• ••1 234"; messages[3].Text != want {
+		t.Errorf("text = %q, want %q", messages[3].Text, want)
+	}
+	if counts[RedactPhone] != 4 {
+		t.Errorf("counted %d phone numbers, want 4", counts[RedactPhone])
+	}
+}
+
+func TestRedactMembership(t *testing.T) {
+	r := NewRedactor(AllRedactCategories)
+
+	messages := []Message{
+		{Sender: "Maria", Text: "Maria added \u202a+44 7700 900234\u202c", Kind: KindSystem},
+		{Sender: "\u202a+44 7700 900234\u202c", Text: "hi all", Kind: KindText},
+		{Sender: "\u202a+44 7700 900234\u202c", Text: "\u202a+44 7700 900234\u202c left", Kind: KindNotice},
+		{Sender: "Maria", Text: "call +359 888 111 234 left", Kind: KindText},
+	}
+	r.RedactMessages(messages)
+
+	var events []MembershipEvent
+	for _, e := range membershipEvents(messages) {
+		events = append(events, e...)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d membership events, want 2: %v", len(events), events)
+	}
+	for _, e := range events {
+		if e.Subject != "Phone 1" {
+			t.Errorf("%s event is about %q, want Phone 1 like the sender", e.Action, e.Subject)
+		}
+	}
+	if want := "call +••• ••• ••1 234 left"; messages[3].Text != want {
+		t.Errorf("typed text = %q, want %q", messages[3].Text, want)
+	}
+
+	in := "22/05/2025, 18:00 - Maria added \u202a+44 7700 900234\u202c\n" +
+		"22/05/2025, 18:01 - \u202a+44 7700 900234\u202c: hi all"
+	want := "22/05/2025, 18:00 - Maria added Phone 1\n" +
+		"22/05/2025, 18:01 - Phone 1: hi all"
+	if got := r.RedactExport(in); got != want {
+		t.Errorf("RedactExport = %q, want %q", got, want)
+	}
+}
+
+func TestRedactExportKeepsFormat(t *testing.T) {
+	r := NewRedactor(AllRedactCategories)
+
+	in := "22/05/2025, 18:01 - +359 888 111 234: call me at 0888 123 456\n" +
+		"22/05/2025, 18:02 - Teo: or mail teo@example.com"
+	want := "22/05/2025, 18:01 - Phone 1: call me at •••• ••3 456\n" +
+		"22/05/2025, 18:02 - Teo: or mail [email]"
+	if got := r.RedactExport(in); got != want {
+		t.Errorf("RedactExport = %q, want %q", got, want)
+	}
+}
+
+func TestMaskDigits(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		keep int
+		want string
+	}{
+		{"+7 985 026-02-62", 4, "+• ••• •••-02-62"},
+		{"123", 4, "123"},
+		{"(02) 987 6543", 0, "(••) ••• ••••"},
+	} {
+		if got := maskDigits(tc.in, tc.keep); got != tc.want {
+			t.Errorf("maskDigits(%q, %d) = %q, want %q", tc.in, tc.keep, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ReplyTime is how long a sender takes to answer someone else, in seconds.
+// Replies, MedianSeconds and P90Seconds only count answers within a
+// conversation; the Overall ones also count messages that restart a dead
+// chat, which measure the silence rather than the sender.
+type ReplyTime struct {
+	Sender               string `json:"sender"`
+	Replies              int    `json:"replies"`
+	MedianSeconds        int    `json:"medianSeconds"`
+	P90Seconds           int    `json:"p90Seconds"`
+	OverallReplies       int    `json:"overallReplies"`
+	OverallMedianSeconds int    `json:"overallMedianSeconds"`
+	OverallP90Seconds    int    `json:"overallP90Seconds"`
+}
+
+// PairReplyTime is how long From takes to answer To, split like ReplyTime.
+type PairReplyTime struct {
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Replies              int    `json:"replies"`
+	MedianSeconds        int    `json:"medianSeconds"`
+	P90Seconds           int    `json:"p90Seconds"`
+	OverallReplies       int    `json:"overallReplies"`
+	OverallMedianSeconds int    `json:"overallMedianSeconds"`
+	OverallP90Seconds    int    `json:"overallP90Seconds"`
+}
+
+// replyTimes returns the reply latency of every sender, fastest within a
+// conversation first, or an error. Senders who only ever restart the chat
+// come last with zero within-conversation latencies.
+func replyTimes(db *sql.DB) ([]ReplyTime, error) {
+	rows, err := db.Query(`SELECT
+			replier,
+			count(*) FILTER (WHERE same_conversation),
+			coalesce(round(median(latency_seconds) FILTER (WHERE same_conversation))::INTEGER, 0),
+			coalesce(round(quantile_cont(latency_seconds, 0.9) FILTER (WHERE same_conversation))::INTEGER, 0),
+			count(*),
+			round(median(latency_seconds))::INTEGER,
+			round(quantile_cont(latency_seconds, 0.9))::INTEGER
+		FROM replies
+		GROUP BY replier
+		ORDER BY median(latency_seconds) FILTER (WHERE same_conversation) NULLS LAST, replier;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply times query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := []ReplyTime{}
+	for rows.Next() {
+		var r ReplyTime
+		if err := rows.Scan(&r.Sender, &r.Replies, &r.MedianSeconds, &r.P90Seconds,
+			&r.OverallReplies, &r.OverallMedianSeconds, &r.OverallP90Seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan reply times: %w", err)
+		}
+		r.Sender = strings.Replace(r.Sender, "- ", "", 1)
+		ret = append(ret, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for reply times: %w", err)
+	}
+	return ret, nil
+}
+
+// replyMatrix returns the reply latency of every pair of senders that
+// answered each other, or an error.
+func replyMatrix(db *sql.DB) ([]PairReplyTime, error) {
+	rows, err := db.Query(`SELECT
+			replier,
+			replied_to,
+			count(*) FILTER (WHERE same_conversation),
+			coalesce(round(median(latency_seconds) FILTER (WHERE same_conversation))::INTEGER, 0),
+			coalesce(round(quantile_cont(latency_seconds, 0.9) FILTER (WHERE same_conversation))::INTEGER, 0),
+			count(*),
+			round(median(latency_seconds))::INTEGER,
+			round(quantile_cont(latency_seconds, 0.9))::INTEGER
+		FROM replies
+		GROUP BY replier, replied_to
+		ORDER BY replier, replied_to;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply matrix query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := []PairReplyTime{}
+	for rows.Next() {
+		var p PairReplyTime
+		if err := rows.Scan(&p.From, &p.To, &p.Replies, &p.MedianSeconds, &p.P90Seconds,
+			&p.OverallReplies, &p.OverallMedianSeconds, &p.OverallP90Seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan reply matrix: %w", err)
+		}
+		p.From = strings.Replace(p.From, "- ", "", 1)
+		p.To = strings.Replace(p.To, "- ", "", 1)
+		ret = append(ret, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for reply matrix: %w", err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChatLine is a message quoted in the stats.
+type ChatLine struct {
+	Timestamp time.Time `json:"timestamp"`
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+}
+
+// LongestSilence is the longest gap between two messages: Ignored is the
+// message nobody answered for GapSeconds, Reply the one that broke the
+// silence and Context the messages leading up to Ignored.
+type LongestSilence struct {
+	GapSeconds int        `json:"gapSeconds"`
+	Context    []ChatLine `json:"context"`
+	Ignored    ChatLine   `json:"ignored"`
+	Reply      ChatLine   `json:"reply"`
+}
+
+// IgnoredCount is how many of the conversations a sender started nobody
+// else joined. Percent is Ignored as a share of Started.
+type IgnoredCount struct {
+	Sender  string `json:"sender"`
+	Ignored int    `json:"ignored"`
+	Started int    `json:"started"`
+	Percent int    `json:"percent"`
+}
+
+// longestSilence returns the longest silence, or nil if the chat has a
+// single message.
+func longestSilence(db *sql.DB) (*LongestSilence, error) {
+	rows, err := db.Query(SilenceQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create longest silence query: %w", err)
+	}
+	defer rows.Close()
+
+	var ret *LongestSilence
+	for rows.Next() {
+		var (
+			line      ChatLine
+			utc, wall time.Time
+			role      string
+			gap       int
+		)
+		if err := rows.Scan(&utc, &wall, &line.Sender, &line.Text, &role, &gap); err != nil {
+			return nil, fmt.Errorf("failed to scan longest silence: %w", err)
+		}
+		line.Timestamp = withOffset(utc, wall)
+		line.Sender = strings.Replace(line.Sender, "- ", "", 1)
+
+		if ret == nil {
+			ret = &LongestSilence{GapSeconds: gap, Context: []ChatLine{}}
+		}
+		switch role {
+		case "ignored":
+			ret.Ignored = line
+		case "reply":
+			ret.Reply = line
+		default:
+			ret.Context = append(ret.Context, line)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for longest silence: %w", err)
+	}
+	return ret, nil
+}
+
+// mostIgnored ranks the senders by the share of the conversations they
+// started that nobody else joined, or returns an error.
+func mostIgnored(db *sql.DB) ([]IgnoredCount, error) {
+	rows, err := db.Query(IgnoredQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create most ignored query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := []IgnoredCount{}
+	for rows.Next() {
+		var c IgnoredCount
+		if err := rows.Scan(&c.Sender, &c.Ignored, &c.Started, &c.Percent); err != nil {
+			return nil, fmt.Errorf("failed to scan most ignored: %w", err)
+		}
+		c.Sender = strings.Replace(c.Sender, "- ", "", 1)
+		ret = append(ret, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for most ignored: %w", err)
+	}
+	return ret, nil
+}
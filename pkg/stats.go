@@ -1,17 +1,43 @@
 package pkg
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 type Stats struct {
-	TotalMessages      int                `json:"totalMessages"`
-	MessagesPerPerson  []MessagePerPerson `json:"messagesPerPerson"`
-	Top3Emojis         []TopEmoji         `json:"top3emojis"`
-	ImagesPerPerson    []MediaCount       `json:"imagesPerPerson"`
-	VideosPerPerson    []MediaCount       `json:"videosPerPerson"`
-	AudioPerPerson     []MediaCount       `json:"AudioPerPerson"`
-	StickersPerPerson  []MediaCount       `json:"stickersPerPerson"`
-	TotalConversations int                `json:"totalConversations"`
-	Duo                Couple             `json:"couple"`
+	TotalMessages     int                `json:"totalMessages"`
+	MessagesPerPerson []MessagePerPerson `json:"messagesPerPerson"`
+	Top3Emojis        []TopEmoji         `json:"top3emojis"`
+	ImagesPerPerson   []MediaCount       `json:"imagesPerPerson"`
+	VideosPerPerson   []MediaCount       `json:"videosPerPerson"`
+	AudioPerPerson    []MediaCount       `json:"AudioPerPerson"`
+	StickersPerPerson []MediaCount       `json:"stickersPerPerson"`
+	// MediaPerPerson counts every attachment, including the ones whose
+	// type is unknown such as Android's "<Media omitted>"
+	MediaPerPerson     []MediaCount    `json:"mediaPerPerson"`
+	TotalConversations int             `json:"totalConversations"`
+	Duo                Couple          `json:"couple"`
+	FirstMessage       time.Time       `json:"firstMessage"`
+	LastMessage        time.Time       `json:"lastMessage"`
+	Heatmap            Heatmap         `json:"heatmap"`
+	HeatmapPerPerson   []PersonHeatmap `json:"heatmapPerPerson"`
+	MessagesPerMonth   []TimelinePoint `json:"messagesPerMonth"`
+	MessagesPerDay     []TimelinePoint `json:"messagesPerDay"`
+	BusiestDay         TimelinePoint   `json:"busiestDay"`
+	Membership         Membership      `json:"membership"`
+	Attachments        AttachmentStats `json:"attachments"`
+	// ReplyTimes is sorted fastest within a conversation first
+	ReplyTimes  []ReplyTime      `json:"replyTimes"`
+	ReplyMatrix []PairReplyTime  `json:"replyMatrix"`
+	Graph       InteractionGraph `json:"interactionGraph"`
+	// LongestSilence is nil for chats with a single message
+	LongestSilence *LongestSilence `json:"longestSilence"`
+	MostIgnored    []IgnoredCount  `json:"mostIgnored"`
+	// Streaks is sorted longest streak first
+	Streaks    []Streak    `json:"streaks"`
+	Monologues []Monologue `json:"monologues"`
+	Activity   Activity    `json:"activity"`
 }
 
 func GetStats(db *sql.DB) Stats {
@@ -22,6 +48,12 @@ func GetStats(db *sql.DB) Stats {
 		ret.TotalMessages = total
 	}
 
+	first, last, err := chatSpan(db)
+	if err == nil {
+		ret.FirstMessage = first
+		ret.LastMessage = last
+	}
+
 	perPerson, err := messagesPerPerson(db)
 	if err == nil {
 		ret.MessagesPerPerson = perPerson
@@ -52,6 +84,11 @@ func GetStats(db *sql.DB) Stats {
 		ret.StickersPerPerson = stickers
 	}
 
+	media, err := mediaCounter(db, "media")
+	if err == nil {
+		ret.MediaPerPerson = media
+	}
+
 	total, err = conversationCount(db)
 	if err == nil {
 		ret.TotalConversations = total
@@ -62,5 +99,72 @@ func GetStats(db *sql.DB) Stats {
 		ret.Duo = duo
 	}
 
+	membership, err := getMembership(db, ret.MessagesPerPerson)
+	if err == nil {
+		ret.Membership = membership
+	}
+
+	attachments, err := attachmentStats(db)
+	if err == nil {
+		ret.Attachments = attachments
+	}
+
+	replies, err := replyTimes(db)
+	if err == nil {
+		ret.ReplyTimes = replies
+	}
+
+	matrix, err := replyMatrix(db)
+	if err == nil {
+		ret.ReplyMatrix = matrix
+	}
+
+	graph, err := interactionGraph(db, ret.MessagesPerPerson)
+	if err == nil {
+		ret.Graph = graph
+	}
+
+	silence, err := longestSilence(db)
+	if err == nil {
+		ret.LongestSilence = silence
+	}
+
+	ignored, err := mostIgnored(db)
+	if err == nil {
+		ret.MostIgnored = ignored
+	}
+
+	personStreaks, err := streaks(db)
+	if err == nil {
+		ret.Streaks = personStreaks
+	}
+
+	longest, err := monologues(db)
+	if err == nil {
+		ret.Monologues = longest
+	}
+
+	daily, err := activity(db)
+	if err == nil {
+		ret.Activity = daily
+	}
+
+	heatmap, perPersonHeatmap, err := heatmaps(db)
+	if err == nil {
+		ret.Heatmap = heatmap
+		ret.HeatmapPerPerson = perPersonHeatmap
+	}
+
+	months, err := timeline(db, "month")
+	if err == nil {
+		ret.MessagesPerMonth = months
+	}
+
+	days, err := timeline(db, "day")
+	if err == nil {
+		ret.MessagesPerDay = days
+		ret.BusiestDay = busiestDay(days)
+	}
+
 	return ret
 }
@@ -0,0 +1,331 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Storage.Get and Storage.Delete when the key
+// doesn't exist.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object as returned by Storage.List.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// ObjectMeta is written alongside an object. Metadata ends up as user
+// metadata (x-amz-meta-*) on s3; the disk and memory backends ignore it.
+type ObjectMeta struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+// Storage is a flat blob store keyed by slash-separated paths such as
+// "results/<uuid>.json".
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, meta ObjectMeta) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// NewStorageFromEnv picks a backend from STORAGE_BACKEND ("s3", "disk" or
+// "memory"). If unset it uses s3 when R2_ENDPOINT is configured and disk
+// otherwise, so the server runs locally without R2 credentials. The disk
+// backend writes below STORAGE_DIR (default "data"). The s3 backend retries
+// failed calls STORAGE_RETRIES times (default 3).
+func NewStorageFromEnv(ctx context.Context) (Storage, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "disk"
+		if os.Getenv("R2_ENDPOINT") != "" {
+			backend = "s3"
+		}
+	}
+
+	switch backend {
+	case "s3":
+		retries := 3
+		if v := os.Getenv("STORAGE_RETRIES"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("STORAGE_RETRIES must be a non-negative integer, got %q", v)
+			}
+			retries = n
+		}
+
+		s, err := NewS3Storage(ctx,
+			os.Getenv("R2_ENDPOINT"),
+			os.Getenv("R2_ACCESS_KEY"),
+			os.Getenv("R2_SECRET_KEY"),
+			os.Getenv("R2_BUCKET"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return WithRetries(s, retries, 200*time.Millisecond), nil
+	case "disk":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "data"
+		}
+		return NewDiskStorage(dir)
+	case "memory":
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+// DiskStorage keeps every object as a file below Dir.
+type DiskStorage struct {
+	Dir string
+}
+
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir: %w", err)
+	}
+	return &DiskStorage{dir}, nil
+}
+
+func (d *DiskStorage) path(key string) (string, error) {
+	p := filepath.FromSlash(key)
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(d.Dir, p), nil
+}
+
+func (d *DiskStorage) Put(_ context.Context, key string, data []byte, _ ObjectMeta) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create dir for %s: %w", key, err)
+	}
+
+	// write then rename so readers never see a half-written object. Every
+	// Put gets its own temp file, so concurrent ones of the same key don't
+	// write into each other's; List skips them by their .tmp suffix.
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", key, err)
+	}
+	return nil
+}
+
+func (d *DiskStorage) Get(_ context.Context, key string) ([]byte, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (d *DiskStorage) Delete(_ context.Context, key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (d *DiskStorage) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	var ret []ObjectInfo
+
+	err := filepath.WalkDir(d.Dir, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		ret = append(ret, ObjectInfo{key, info.Size(), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	return ret, nil
+}
+
+// MemoryStorage keeps objects in a map. It is meant for tests and local
+// runs; everything is lost on restart.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+func (m *MemoryStorage) Put(_ context.Context, key string, data []byte, _ ObjectMeta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{bytes.Clone(data), time.Now()}
+	return nil
+}
+
+func (m *MemoryStorage) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(o.data), nil
+}
+
+func (m *MemoryStorage) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.objects[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *MemoryStorage) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ret []ObjectInfo
+	for k, o := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			ret = append(ret, ObjectInfo{k, int64(len(o.data)), o.modTime})
+		}
+	}
+	return ret, nil
+}
+
+// retryStorage retries every failed call except ErrNotFound with
+// exponential backoff.
+type retryStorage struct {
+	Storage
+	retries int
+	backoff time.Duration
+}
+
+// WithRetries wraps s so that failed calls are retried up to `retries`
+// times, waiting backoff, 2*backoff, 4*backoff... in between.
+func WithRetries(s Storage, retries int, backoff time.Duration) Storage {
+	return &retryStorage{s, retries, backoff}
+}
+
+func (r *retryStorage) do(ctx context.Context, fn func() error) error {
+	wait := r.backoff
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || errors.Is(err, ErrNotFound) || attempt >= r.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (r *retryStorage) Put(ctx context.Context, key string, data []byte, meta ObjectMeta) error {
+	return r.do(ctx, func() error {
+		return r.Storage.Put(ctx, key, data, meta)
+	})
+}
+
+func (r *retryStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := r.do(ctx, func() error {
+		var err error
+		data, err = r.Storage.Get(ctx, key)
+		return err
+	})
+	return data, err
+}
+
+func (r *retryStorage) Delete(ctx context.Context, key string) error {
+	return r.do(ctx, func() error {
+		return r.Storage.Delete(ctx, key)
+	})
+}
+
+func (r *retryStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := r.do(ctx, func() error {
+		var err error
+		objects, err = r.Storage.List(ctx, prefix)
+		return err
+	})
+	return objects, err
+}
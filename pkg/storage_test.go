@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStorage is the contract every backend has to fulfil.
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "results/missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key returned %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "results/missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing key returned %v, want ErrNotFound", err)
+	}
+
+	objects := map[string]string{
+		"results/a.json": "first",
+		"results/b.json": "second",
+		"uploads/a.txt":  "chat",
+	}
+	for key, data := range objects {
+		if err := s.Put(ctx, key, []byte(data), ObjectMeta{ContentType: "text/plain"}); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	if err := s.Put(ctx, "results/a.json", []byte("overwritten"), ObjectMeta{}); err != nil {
+		t.Fatalf("Put over an existing key: %v", err)
+	}
+	objects["results/a.json"] = "overwritten"
+
+	for key, want := range objects {
+		got, err := s.Get(ctx, key)
+		if err != nil {
+			t.Errorf("Get %s: %v", key, err)
+		} else if string(got) != want {
+			t.Errorf("Get %s = %q, want %q", key, got, want)
+		}
+	}
+
+	listed, err := s.List(ctx, "results/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range listed {
+		keys = append(keys, o.Key)
+		if o.Size != int64(len(objects[o.Key])) {
+			t.Errorf("List reports %s as %d bytes, want %d", o.Key, o.Size, len(objects[o.Key]))
+		}
+		if o.ModTime.IsZero() {
+			t.Errorf("List reports no modification time for %s", o.Key)
+		}
+	}
+	slices.Sort(keys)
+	if want := []string{"results/a.json", "results/b.json"}; !slices.Equal(keys, want) {
+		t.Errorf("List(results/) = %v, want %v", keys, want)
+	}
+
+	if err := s.Delete(ctx, "results/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "results/a.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	if listed, err := s.List(ctx, "results/"); err != nil || len(listed) != 1 {
+		t.Errorf("List after Delete = %v, %v, want one object", listed, err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestDiskStorage(t *testing.T) {
+	s, err := NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+
+	if err := s.Put(context.Background(), "../escape.txt", nil, ObjectMeta{}); err == nil {
+		t.Error("Put accepted a key outside the storage dir")
+	}
+}
+
+func TestDiskStorageConcurrentPuts(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions := []string{"first version", "second, longer version", "third"}
+	var wg sync.WaitGroup
+	for range 20 {
+		for _, v := range versions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.Put(ctx, "results/a.json", []byte(v), ObjectMeta{}); err != nil {
+					t.Errorf("Put: %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	got, err := s.Get(ctx, "results/a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(versions, string(got)) {
+		t.Errorf("Get = %q, want one of the versions whole", got)
+	}
+
+	// no temp files are left behind
+	entries, err := os.ReadDir(filepath.Join(s.Dir, "results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("results/ holds %d files after the Puts, want 1", len(entries))
+	}
+}
+
+// flakyStorage fails the first `failures` calls to Get with err.
+type flakyStorage struct {
+	Storage
+	failures int
+	err      error
+	calls    []time.Time
+}
+
+func (f *flakyStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	f.calls = append(f.calls, time.Now())
+	if len(f.calls) <= f.failures {
+		return nil, f.err
+	}
+	return f.Storage.Get(ctx, key)
+}
+
+func TestRetriesBackOff(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStorage()
+	if err := mem.Put(ctx, "key", []byte("data"), ObjectMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	backoff := 10 * time.Millisecond
+	flaky := &flakyStorage{Storage: mem, failures: 3, err: errors.New("connection reset")}
+
+	data, err := WithRetries(flaky, 3, backoff).Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get failed after retries: %v", err)
+	}
+	if string(data) != "data" {
+		t.Errorf("Get = %q, want %q", data, "data")
+	}
+	if len(flaky.calls) != 4 {
+		t.Fatalf("Get was tried %d times, want 4", len(flaky.calls))
+	}
+
+	// the waits double: backoff, 2*backoff, 4*backoff
+	for i := 1; i < len(flaky.calls); i++ {
+		want := backoff << (i - 1)
+		if waited := flaky.calls[i].Sub(flaky.calls[i-1]); waited < want {
+			t.Errorf("waited %s before try %d, want at least %s", waited, i+1, want)
+		}
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("connection reset")
+
+	flaky := &flakyStorage{Storage: NewMemoryStorage(), failures: 10, err: failure}
+	if _, err := WithRetries(flaky, 2, time.Millisecond).Get(ctx, "key"); !errors.Is(err, failure) {
+		t.Errorf("Get returned %v, want %v", err, failure)
+	}
+	if len(flaky.calls) != 3 {
+		t.Errorf("Get was tried %d times, want 3", len(flaky.calls))
+	}
+
+	// a missing key is an answer, not a failure
+	flaky = &flakyStorage{Storage: NewMemoryStorage(), failures: 10, err: ErrNotFound}
+	if _, err := WithRetries(flaky, 2, time.Millisecond).Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get returned %v, want ErrNotFound", err)
+	}
+	if len(flaky.calls) != 1 {
+		t.Errorf("ErrNotFound was retried %d times", len(flaky.calls)-1)
+	}
+
+	// a cancelled context stops the backoff
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	flaky = &flakyStorage{Storage: NewMemoryStorage(), failures: 10, err: failure}
+	if _, err := WithRetries(flaky, 5, time.Hour).Get(cancelled, "key"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get returned %v, want context.Canceled", err)
+	}
+	if len(flaky.calls) != 1 {
+		t.Errorf("Get was tried %d times after cancel, want 1", len(flaky.calls))
+	}
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Streak describes a sender's bursts, runs of back-to-back messages within
+// a conversation. DoubleTexts counts the bursts of two messages or more.
+type Streak struct {
+	Sender       string  `json:"sender"`
+	Longest      int     `json:"longest"`
+	Bursts       int     `json:"bursts"`
+	DoubleTexts  int     `json:"doubleTexts"`
+	AverageBurst float64 `json:"averageBurst"`
+}
+
+// Monologue is one of the longest bursts.
+type Monologue struct {
+	Sender   string    `json:"sender"`
+	Messages int       `json:"messages"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// topMonologues is how many monologues the stats list.
+const topMonologues = 5
+
+// streaks returns the bursts of every sender, longest streak first, or an
+// error.
+func streaks(db *sql.DB) ([]Streak, error) {
+	rows, err := db.Query(`SELECT
+			msg_sender,
+			max(messages)                    AS longest,
+			count(*),
+			count(*) FILTER (WHERE messages >= 2),
+			round(avg(messages), 2)
+		FROM bursts
+		GROUP BY msg_sender
+		ORDER BY longest DESC, msg_sender;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create streaks query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := []Streak{}
+	for rows.Next() {
+		var s Streak
+		if err := rows.Scan(&s.Sender, &s.Longest, &s.Bursts, &s.DoubleTexts, &s.AverageBurst); err != nil {
+			return nil, fmt.Errorf("failed to scan streaks: %w", err)
+		}
+		s.Sender = strings.Replace(s.Sender, "- ", "", 1)
+		ret = append(ret, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for streaks: %w", err)
+	}
+	return ret, nil
+}
+
+// monologues returns the longest bursts, earliest first on ties, or an
+// error.
+func monologues(db *sql.DB) ([]Monologue, error) {
+	rows, err := db.Query(`SELECT msg_sender, messages, start_utc, start_ts, end_utc, end_ts
+		FROM bursts
+		WHERE messages >= 2
+		ORDER BY messages DESC, start_utc
+		LIMIT ?;`, topMonologues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create monologues query: %w", err)
+	}
+	defer rows.Close()
+
+	ret := []Monologue{}
+	for rows.Next() {
+		var (
+			m                                    Monologue
+			startUTC, startWall, endUTC, endWall time.Time
+		)
+		if err := rows.Scan(&m.Sender, &m.Messages, &startUTC, &startWall, &endUTC, &endWall); err != nil {
+			return nil, fmt.Errorf("failed to scan monologues: %w", err)
+		}
+		m.Sender = strings.Replace(m.Sender, "- ", "", 1)
+		m.Start = withOffset(startUTC, startWall)
+		m.End = withOffset(endUTC, endWall)
+		ret = append(ret, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for monologues: %w", err)
+	}
+	return ret, nil
+}
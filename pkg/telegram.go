@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TelegramExport is the subset of a Telegram Desktop `result.json` export
+// that we care about.
+type TelegramExport struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Messages []TelegramMessage `json:"messages"`
+}
+
+// TelegramMessage is a single entry of the `messages` array. Service
+// messages (joins, pins, renames...) have Type "service" and carry an Actor
+// and an Action instead of From/Text.
+type TelegramMessage struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	Date      string          `json:"date"`
+	From      string          `json:"from"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Title     string          `json:"title"`
+	Members   []string        `json:"members"`
+	Text      json.RawMessage `json:"text"`
+	MediaType string          `json:"media_type"`
+	Photo     string          `json:"photo"`
+	File      string          `json:"file"`
+}
+
+// telegramDateLayout is the layout of the `date` field, written in the
+// exporting machine's local time.
+const telegramDateLayout = "2006-01-02T15:04:05"
+
+// GetRawLinesTelegram turns a Telegram Desktop JSON export into the same
+// Messages the WhatsApp parsers produce, so PrepDB and everything
+// downstream work unchanged. Media gets the matching MessageKind (keeping
+// any caption as Text) and service messages become KindSystem.
+func GetRawLinesTelegram(content string) ([]Message, error) {
+	var export TelegramExport
+	if err := json.Unmarshal([]byte(content), &export); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode telegram export: %v", ErrUnknownFormat, err)
+	}
+
+	messages := []Message{}
+	for _, m := range export.Messages {
+		parsed, err := time.Parse(telegramDateLayout, m.Date)
+		if err != nil {
+			return nil, ErrBadTimestamp{m.ID, m.Date, err}
+		}
+
+		if m.Type == "service" {
+			actor := strings.TrimSpace(m.Actor)
+			messages = append(messages, Message{parsed, actor, telegramServiceText(actor, m), KindSystem, nil})
+			continue
+		}
+		if m.Type != "message" {
+			continue
+		}
+
+		sender := strings.TrimSpace(m.From)
+		if sender == "" {
+			sender = "Deleted Account"
+		}
+
+		text := strings.TrimSpace(telegramText(m.Text))
+		kind := telegramKind(m)
+		if kind == KindText && text == "" {
+			continue
+		}
+
+		messages = append(messages, Message{parsed, sender, text, kind, nil})
+	}
+
+	if len(messages) == 0 {
+		return nil, ErrEmptyChat
+	}
+	return messages, nil
+}
+
+// telegramServiceText writes membership service messages the way WhatsApp
+// does, so they end up in the same membership events. Other actions are
+// kept as their name.
+func telegramServiceText(actor string, m TelegramMessage) string {
+	members := strings.Join(m.Members, ", ")
+	switch m.Action {
+	case "create_group":
+		return fmt.Sprintf("%s created group %q", actor, m.Title)
+	case "invite_members":
+		return actor + " added " + members
+	case "remove_members":
+		// leaving shows up as removing yourself
+		if len(m.Members) == 1 && m.Members[0] == actor {
+			return actor + " left"
+		}
+		return actor + " removed " + members
+	case "join_group_by_link":
+		return actor + " joined using this group's invite link"
+	case "edit_group_title":
+		return fmt.Sprintf("%s changed the group name to %q", actor, m.Title)
+	case "edit_group_photo":
+		return actor + " changed this group's icon"
+	case "delete_group_photo":
+		return actor + " deleted this group's icon"
+	default:
+		return m.Action
+	}
+}
+
+// telegramKind maps Telegram media onto the kinds prep.sql uses to fill the
+// media helper tables.
+func telegramKind(m TelegramMessage) MessageKind {
+	if m.Photo != "" {
+		return KindImage
+	}
+
+	switch m.MediaType {
+	case "sticker":
+		return KindSticker
+	case "video_file", "video_message", "animation":
+		return KindVideo
+	case "voice_message", "audio_file":
+		return KindAudio
+	}
+
+	return KindText
+}
+
+// telegramText flattens the `text` field, which is either a plain string or
+// an array mixing strings and formatted entities like {"type": "bold",
+// "text": "..."}.
+func telegramText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var plain string
+	if err := json.Unmarshal(raw, &plain); err == nil {
+		return plain
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, p := range parts {
+		var s string
+		if err := json.Unmarshal(p, &s); err == nil {
+			sb.WriteString(s)
+			continue
+		}
+
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(p, &entity); err == nil {
+			sb.WriteString(entity.Text)
+		}
+	}
+
+	return sb.String()
+}
@@ -3,6 +3,7 @@ package pkg
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -10,24 +11,108 @@ import (
 	"github.com/araddon/dateparse"
 )
 
+// DateOrder says whether numeric dates such as 3/4/25 are day-first or
+// month-first. The empty DateOrder means it is inferred from the export.
+type DateOrder string
+
+const (
+	DateOrderAuto DateOrder = ""
+	DayFirst      DateOrder = "dmy"
+	MonthFirst    DateOrder = "mdy"
+)
+
+// ParseDateOrder parses "dmy", "mdy" or "" (infer).
+func ParseDateOrder(s string) (DateOrder, error) {
+	switch o := DateOrder(strings.ToLower(strings.TrimSpace(s))); o {
+	case DateOrderAuto, DayFirst, MonthFirst:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unknown date order %q", s)
+	}
+}
+
+// InferDateOrder decides the order once for a whole export from all of its
+// header timestamps, so that 3/4 and 13/4 are never read differently. A
+// first component above 12 proves day-first, a second one above 12 proves
+// month-first. Without proof dotted dates and four-digit years are taken as
+// day-first, since no locale writes m.d.y and US exports write m/d/yy; other
+// slashed dates are ErrAmbiguousDateOrder, as are exports that prove both.
+// Year-first dates read the same in every locale, so exports written only
+// with those get DayFirst, which leaves them as they are.
+func InferDateOrder(timestamps []string) (DateOrder, error) {
+	var dayFirst, monthFirst, dotted, fourDigitYear, yearFirst, numeric bool
+	for _, ts := range timestamps {
+		datePart, _, _ := strings.Cut(strings.TrimSpace(strings.ReplaceAll(ts, ",", "")), " ")
+		parts := strings.FieldsFunc(datePart, func(r rune) bool {
+			return r == '.' || r == '/' || r == '-'
+		})
+		if len(parts) != 3 {
+			continue // not numeric d/m/y
+		}
+		if len(parts[0]) > 2 {
+			yearFirst = true
+			continue
+		}
+		a, b, _, err := atoi3(parts)
+		if err != nil {
+			continue
+		}
+
+		numeric = true
+		dotted = dotted || strings.Contains(datePart, ".")
+		fourDigitYear = fourDigitYear || len(parts[2]) == 4
+		dayFirst = dayFirst || a > 12
+		monthFirst = monthFirst || b > 12
+	}
+
+	switch {
+	case dayFirst && monthFirst:
+		return "", ErrAmbiguousDateOrder
+	case dayFirst:
+		return DayFirst, nil
+	case monthFirst:
+		return MonthFirst, nil
+	case dotted, fourDigitYear:
+		return DayFirst, nil
+	case yearFirst && !numeric:
+		return DayFirst, nil
+	default:
+		return "", ErrAmbiguousDateOrder
+	}
+}
+
+// dateR is the day, month and year every timestamp starts with, in any
+// order and separated by dots, slashes or dashes. Without it dateparse
+// would read "2024" alone as January 1st.
+var dateR = regexp.MustCompile(`^\d{1,4}[./-]\d{1,2}[./-]\d{1,4}(?:\D|$)`)
+
+// looksLikeDate reports whether s starts with a full numeric date.
+func looksLikeDate(s string) bool {
+	return dateR.MatchString(strings.TrimSpace(s))
+}
+
 // ParseFlexible converts strings such as
 //
 //	6.09.25, 15:00:00
 //	06/09/2025 15:00:00
 //	9/6/25, 3:00:00 PM
 //
-// to a time.Time.  It first tries a fast custom parser for those three
-// layouts; if that fails it falls back to dateparse.ParseLocal, which
-// understands a very large set of formats.
+// to a time.Time, reading numeric dates in the given order (see
+// InferDateOrder). It first tries a fast custom parser for those three
+// layouts; if that fails it falls back to dateparse, which understands a
+// very large set of formats, as long as they start with a numeric date.
 //
-// The result is in the machine's local zone; switch to time.UTC if you
-// prefer UTC.
-func ParseFlexible(input string) (time.Time, error) {
-	if t, err := parseFlexibleCustom(input); err == nil {
-		return t.UTC(), nil
+// The result is the wall clock time as written, labelled UTC whatever zone
+// the server runs in; Localize attaches the zone the export was written in.
+func ParseFlexible(input string, order DateOrder) (time.Time, error) {
+	if !looksLikeDate(input) {
+		return time.Time{}, fmt.Errorf("flexdatetime: no day, month and year in %q", input)
 	}
-	if t, err := dateparse.ParseLocal(strings.TrimSpace(strings.ReplaceAll(input, ",", ""))); err == nil {
-		return t.UTC(), nil
+	if t, err := parseFlexibleCustom(input, order); err == nil {
+		return t, nil
+	}
+	if t, err := dateparse.ParseIn(strings.TrimSpace(strings.ReplaceAll(input, ",", "")), time.UTC, dateparse.PreferMonthFirst(order == MonthFirst)); err == nil {
+		return t, nil
 	}
 	return time.Time{}, fmt.Errorf("flexdatetime: unrecognised datetime %q", input)
 }
@@ -37,7 +122,7 @@ func ParseFlexible(input string) (time.Time, error) {
 // unexported helper.
 // ----------------------------------------------------------------------
 
-func parseFlexibleCustom(input string) (time.Time, error) {
+func parseFlexibleCustom(input string, order DateOrder) (time.Time, error) {
 	input = strings.TrimSpace(strings.ReplaceAll(input, ",", ""))
 	parts := strings.SplitN(input, " ", 2)
 	if len(parts) != 2 {
@@ -52,7 +137,7 @@ func parseFlexibleCustom(input string) (time.Time, error) {
 	}
 
 	// --- date ---
-	d, m, y, err := parseDatePart(datePart)
+	d, m, y, err := parseDatePart(datePart, order)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -60,6 +145,11 @@ func parseFlexibleCustom(input string) (time.Time, error) {
 		y += 2000
 	}
 
+	// time.Date happily normalises 99.99.25, so reject it here
+	if m < 1 || m > 12 || d < 1 || d > 31 {
+		return time.Time{}, errors.New("date component out of range")
+	}
+
 	return time.Date(y, time.Month(m), d, tm.Hour(), tm.Minute(), tm.Second(), 0, time.UTC), nil
 }
 
@@ -73,24 +163,25 @@ func parseTimePart(timePart string) (time.Time, error) {
 	return time.Time{}, errors.New("time component not recognised")
 }
 
-func parseDatePart(datePart string) (d, m, y int, err error) {
+func parseDatePart(datePart string, order DateOrder) (d, m, y int, err error) {
+	var parts []string
 	switch {
 	case strings.Contains(datePart, "."): // BG  d.m.yy or d.m.yyyy
-		return atoi3(strings.Split(datePart, "."))
+		parts = strings.Split(datePart, ".")
 	case strings.Contains(datePart, "/"): // UK or US
-		a, b, c, err := atoi3(strings.Split(datePart, "/"))
-		if err != nil {
-			return 0, 0, 0, err
-		}
-		switch {
-		case len(strings.Split(datePart, "/")[2]) == 4, a > 12: // day first
-			return a, b, c, nil
-		default: // month first
-			return b, a, c, nil
-		}
+		parts = strings.Split(datePart, "/")
 	default:
 		return 0, 0, 0, errors.New("unknown date separator")
 	}
+
+	a, b, c, err := atoi3(parts)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if order == MonthFirst {
+		return b, a, c, nil
+	}
+	return a, b, c, nil
 }
 
 func atoi3(ss []string) (a, b, c int, err error) {
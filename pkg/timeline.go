@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Heatmap counts messages by weekday (rows, Monday first) and hour of the
+// day (columns).
+type Heatmap [7][24]int
+
+type PersonHeatmap struct {
+	Sender  string  `json:"sender"`
+	Heatmap Heatmap `json:"heatmap"`
+}
+
+// TimelinePoint is the number of messages sent on a day (2006-01-02) or in
+// a month (2006-01).
+type TimelinePoint struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// heatmaps returns the heatmap of the whole group and one per sender,
+// busiest sender first, or an error.
+func heatmaps(db *sql.DB) (Heatmap, []PersonHeatmap, error) {
+	rows, err := db.Query(`SELECT msg_sender, isodow(msg_timestamp) - 1, hour(msg_timestamp), count(*)
+		FROM chat
+		GROUP BY ALL;`)
+	if err != nil {
+		return Heatmap{}, nil, fmt.Errorf("failed to create heatmap query: %w", err)
+	}
+	defer rows.Close()
+
+	var group Heatmap
+	perPerson := make(map[string]*Heatmap)
+	totals := make(map[string]int)
+	for rows.Next() {
+		var (
+			sender           string
+			day, hour, count int
+		)
+		if err := rows.Scan(&sender, &day, &hour, &count); err != nil {
+			return Heatmap{}, nil, fmt.Errorf("failed to scan heatmap: %w", err)
+		}
+
+		sender = strings.Replace(sender, "- ", "", 1)
+		if perPerson[sender] == nil {
+			perPerson[sender] = &Heatmap{}
+		}
+		perPerson[sender][day][hour] += count
+		group[day][hour] += count
+		totals[sender] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return Heatmap{}, nil, fmt.Errorf("iteration error for heatmap: %w", err)
+	}
+
+	ret := make([]PersonHeatmap, 0, len(perPerson))
+	for sender, h := range perPerson {
+		ret = append(ret, PersonHeatmap{sender, *h})
+	}
+	slices.SortFunc(ret, func(a, b PersonHeatmap) int {
+		return cmp.Or(cmp.Compare(totals[b.Sender], totals[a.Sender]), cmp.Compare(a.Sender, b.Sender))
+	})
+	return group, ret, nil
+}
+
+// timeline returns the messages per day or month ("day" or "month") from
+// the first to the last message. Days or months without messages are
+// included with a count of 0 so charts don't skip them.
+func timeline(db *sql.DB, unit string) ([]TimelinePoint, error) {
+	layout := map[string]string{"day": "2006-01-02", "month": "2006-01"}[unit]
+
+	rows, err := db.Query(`WITH buckets AS (
+		SELECT unnest(generate_series(
+			date_trunc('` + unit + `', min(msg_timestamp)),
+			date_trunc('` + unit + `', max(msg_timestamp)),
+			INTERVAL 1 ` + unit + `
+		)) AS bucket
+		FROM chat
+	)
+	SELECT bucket, count(chat.msg_id)
+	FROM buckets
+	LEFT JOIN chat ON date_trunc('` + unit + `', chat.msg_timestamp) = bucket
+	GROUP BY bucket
+	ORDER BY bucket;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create timeline query (%s): %w", unit, err)
+	}
+	defer rows.Close()
+
+	var ret []TimelinePoint
+	for rows.Next() {
+		var (
+			bucket time.Time
+			count  int
+		)
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan timeline: %w", err)
+		}
+		ret = append(ret, TimelinePoint{bucket.Format(layout), count})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iteration error for timeline: %w", err)
+	}
+	return ret, nil
+}
+
+// busiestDay is the day with the most messages, the earliest one if several
+// tie.
+func busiestDay(days []TimelinePoint) TimelinePoint {
+	var ret TimelinePoint
+	for _, d := range days {
+		if d.Count > ret.Count {
+			ret = d
+		}
+	}
+	return ret
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// the zone database is embedded so LoadLocation works in slim containers
+	_ "time/tzdata"
+)
+
+// ResolveLocation picks the time zone an export was written in. name is an
+// IANA zone such as "Europe/Sofia". If it is empty, offset is tried: the
+// client's offset in minutes as returned by JavaScript's
+// Date.getTimezoneOffset(), so -120 for UTC+2. Failing both, the zone is
+// guessed from the Accept-Language header and UTC is the last resort.
+func ResolveLocation(name, offset, acceptLanguage string) (*time.Location, error) {
+	if name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", name)
+		}
+		return loc, nil
+	}
+
+	if offset != "" {
+		minutes, err := strconv.Atoi(offset)
+		if err != nil || minutes < -14*60 || minutes > 14*60 {
+			return nil, fmt.Errorf("invalid time zone offset %q", offset)
+		}
+
+		east := -minutes
+		sign := "+"
+		if east < 0 {
+			sign = "-"
+			east = -east
+		}
+		return time.FixedZone(fmt.Sprintf("UTC%s%02d:%02d", sign, east/60, east%60), -minutes*60), nil
+	}
+
+	if loc := guessLocation(acceptLanguage); loc != nil {
+		return loc, nil
+	}
+	return time.UTC, nil
+}
+
+// regionZones maps a country to the zone most of its people live in.
+var regionZones = map[string]string{
+	"AU": "Australia/Sydney", "BG": "Europe/Sofia", "BR": "America/Sao_Paulo",
+	"CA": "America/Toronto", "CN": "Asia/Shanghai", "DE": "Europe/Berlin",
+	"ES": "Europe/Madrid", "FR": "Europe/Paris", "GB": "Europe/London",
+	"GR": "Europe/Athens", "IE": "Europe/Dublin", "IN": "Asia/Kolkata",
+	"IT": "Europe/Rome", "JP": "Asia/Tokyo", "MX": "America/Mexico_City",
+	"NL": "Europe/Amsterdam", "PL": "Europe/Warsaw", "PT": "Europe/Lisbon",
+	"RO": "Europe/Bucharest", "RU": "Europe/Moscow", "SE": "Europe/Stockholm",
+	"TR": "Europe/Istanbul", "UA": "Europe/Kyiv", "US": "America/New_York",
+}
+
+// languageZones covers tags without a region, which mostly name the
+// language's home country.
+var languageZones = map[string]string{
+	"bg": "Europe/Sofia", "de": "Europe/Berlin", "el": "Europe/Athens",
+	"fr": "Europe/Paris", "it": "Europe/Rome", "ja": "Asia/Tokyo",
+	"nl": "Europe/Amsterdam", "pl": "Europe/Warsaw", "ro": "Europe/Bucharest",
+	"ru": "Europe/Moscow", "sv": "Europe/Stockholm", "tr": "Europe/Istanbul",
+	"uk": "Europe/Kyiv", "zh": "Asia/Shanghai",
+}
+
+// guessLocation returns the zone of the first Accept-Language tag we know,
+// or nil. Tags are taken in the order the client sent them, which browsers
+// already sort by preference.
+func guessLocation(acceptLanguage string) *time.Location {
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), ";")
+		lang, region, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+
+		name, ok := regionZones[strings.ToUpper(region)]
+		if !ok {
+			name, ok = languageZones[strings.ToLower(lang)]
+		}
+		if !ok {
+			continue
+		}
+
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return nil
+}
+
+// Localize attaches loc to the parsed timestamps. Parsers return the wall
+// clock time as written in the export labelled UTC, since exports don't say
+// which zone the phone was in.
+func Localize(messages []Message, loc *time.Location) {
+	for i, m := range messages {
+		t := m.Timestamp
+		messages[i].Timestamp = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+}
+
+// wallClock is the inverse of Localize: t's local time labelled UTC, which
+// is what DuckDB's zone-less TIMESTAMP columns hold.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"group-wrapped/pkg"
+	"log"
+	"time"
+)
+
+// ErrBadDeleteToken is returned by ResultStore.Delete and ChatArchive.Delete
+// when the caller doesn't hold the token handed out with the upload.
+var ErrBadDeleteToken = errors.New("invalid delete token")
+
+const resultsPrefix = "results/"
+
+// storedResult is what actually lands in storage. Only the hash of the
+// delete token is kept, so a storage leak can't be used to delete results.
+type storedResult struct {
+	Output          Output    `json:"output"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	DeleteTokenHash string    `json:"deleteTokenHash"`
+}
+
+// Result is a saved Output as served by GET /results/:id.
+type Result struct {
+	ID        string    `json:"id"`
+	Output    Output    `json:"output"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ResultStore persists finished analyses so they can be shared by link.
+type ResultStore struct {
+	storage pkg.Storage
+	ttl     time.Duration
+}
+
+func NewResultStore(storage pkg.Storage, ttl time.Duration) *ResultStore {
+	return &ResultStore{storage, ttl}
+}
+
+func resultKey(id string) string {
+	return resultsPrefix + id + ".json"
+}
+
+// Save stores out under id. token is the upload's delete token from
+// newDeleteToken and is needed to delete the result again.
+func (s *ResultStore) Save(ctx context.Context, id string, out Output, token string) (time.Time, error) {
+	stored := storedResult{
+		Output:          out,
+		ExpiresAt:       time.Now().Add(s.ttl).UTC(),
+		DeleteTokenHash: hashToken(token),
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	if err := s.storage.Put(ctx, resultKey(id), data, pkg.ObjectMeta{ContentType: "application/json"}); err != nil {
+		return time.Time{}, err
+	}
+	return stored.ExpiresAt, nil
+}
+
+// Load returns the result saved under id, or pkg.ErrNotFound if it never
+// existed or has expired.
+func (s *ResultStore) Load(ctx context.Context, id string) (Result, error) {
+	stored, err := s.load(ctx, id)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{id, stored.Output, stored.ExpiresAt}, nil
+}
+
+// Delete removes the result if token matches the one passed to Save.
+func (s *ResultStore) Delete(ctx context.Context, id, token string) error {
+	stored, err := s.load(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !tokenMatches(token, stored.DeleteTokenHash) {
+		return ErrBadDeleteToken
+	}
+
+	return s.storage.Delete(ctx, resultKey(id))
+}
+
+// Sweep deletes every result older than the TTL.
+func (s *ResultStore) Sweep() {
+	ctx := context.Background()
+
+	objects, err := s.storage.List(ctx, resultsPrefix)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, o := range objects {
+		if time.Since(o.ModTime) <= s.ttl {
+			continue
+		}
+		if err := s.storage.Delete(ctx, o.Key); err != nil && !errors.Is(err, pkg.ErrNotFound) {
+			log.Println(err)
+		}
+	}
+}
+
+func (s *ResultStore) load(ctx context.Context, id string) (storedResult, error) {
+	data, err := s.storage.Get(ctx, resultKey(id))
+	if err != nil {
+		return storedResult{}, err
+	}
+
+	var stored storedResult
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return storedResult{}, fmt.Errorf("failed to decode result %s: %w", id, err)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return storedResult{}, pkg.ErrNotFound
+	}
+	return stored, nil
+}
+
+// newDeleteToken returns a random token that proves ownership of an upload.
+// Only its hash is ever stored.
+func newDeleteToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate delete token: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenMatches(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(hash)) == 1
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"group-wrapped/pkg"
+	"testing"
+	"time"
+)
+
+func TestResultRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := NewResultStore(pkg.NewMemoryStorage(), time.Hour)
+
+	out := Output{Timezone: "Europe/Sofia"}
+	expires, err := store.Save(ctx, "abc", out, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "abc" || got.Output.Timezone != out.Timezone || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("Load = %+v, want %+v expiring at %s", got, out, expires)
+	}
+
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("Load of a missing result returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpiredResultIsNotFound(t *testing.T) {
+	ctx := context.Background()
+	store := NewResultStore(pkg.NewMemoryStorage(), -time.Second)
+
+	if _, err := store.Save(ctx, "abc", Output{}, "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(ctx, "abc"); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("Load of an expired result returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "abc", "token"); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("Delete of an expired result returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteChecksToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewResultStore(pkg.NewMemoryStorage(), time.Hour)
+
+	token, err := newDeleteToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Save(ctx, "abc", Output{}, token); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, wrong := range []string{"", "token", hashToken(token)} {
+		if err := store.Delete(ctx, "abc", wrong); !errors.Is(err, ErrBadDeleteToken) {
+			t.Errorf("Delete with token %q returned %v, want ErrBadDeleteToken", wrong, err)
+		}
+	}
+	if _, err := store.Load(ctx, "abc"); err != nil {
+		t.Fatalf("result is gone after rejected deletes: %v", err)
+	}
+
+	if err := store.Delete(ctx, "abc", token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "abc"); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("Load after Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestSweepDeletesOnlyExpiredResults(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	if _, err := NewResultStore(storage, time.Hour).Save(ctx, "old", Output{}, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, "uploads/old.txt", []byte("chat"), pkg.ObjectMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	NewResultStore(storage, time.Millisecond).Sweep()
+
+	if _, err := storage.Get(ctx, resultKey("old")); !errors.Is(err, pkg.ErrNotFound) {
+		t.Errorf("expired result survived the sweep: %v", err)
+	}
+	if _, err := storage.Get(ctx, "uploads/old.txt"); err != nil {
+		t.Errorf("sweep deleted an object outside %s: %v", resultsPrefix, err)
+	}
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"group-wrapped/pkg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+// cards are dealt with a fixed seed so the golden files stay stable
+const goldenSeed = 1
+
+var fixtures = []struct {
+	golden string
+	file   string
+	dates  pkg.DateRange
+	order  pkg.DateOrder
+}{
+	{"albert", "albert.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"android", "android.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// attachments named like IMG-20250614-WA0001.jpg
+	{"android_media", "android_media.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"bg", "bg.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"bg-september", "bg.txt", pkg.DateRange{
+		From: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}, pkg.DateOrderAuto},
+	{"uk", "uk.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// no day above 12, the four-digit year makes it day-first
+	{"uk_short", "uk_short.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// ISO dates, which read the same in either order
+	{"year_first", "year_first.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// continuation lines that look like headers but aren't timestamps
+	{"continuations", "continuations.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// a header whose date is out of range fails with its line number
+	{"bad_timestamp", "bad_timestamp.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// every date in us.txt reads both ways
+	{"us", "us.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// same, but with a conversation that survives; read as asked for
+	{"us_short", "us_short.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"us_short-month-first", "us_short.txt", pkg.DateRange{}, pkg.MonthFirst},
+	{"us_short-day-first", "us_short.txt", pkg.DateRange{}, pkg.DayFirst},
+	{"telegram", "telegram.json", pkg.DateRange{}, pkg.DateOrderAuto},
+	// exported with media, the chat isn't the first entry
+	{"android_with_media", "android_with_media.zip", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"ios_with_media", "ios_with_media.zip", pkg.DateRange{}, pkg.DateOrderAuto},
+	// 8 MB of zeros posing as a photo
+	{"zip_bomb", "zip_bomb.zip", pkg.DateRange{}, pkg.DateOrderAuto},
+	// a voice note that fits, then the same photo past the media limit
+	{"media_over_budget", "media_over_budget.zip", pkg.DateRange{}, pkg.DateOrderAuto},
+	// members leaving, being removed and renaming the group, next to
+	// members typing the same words
+	{"membership_android", "membership_android.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"membership_ios", "membership_ios.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	// the creator of a Telegram group typing what looks like an event
+	{"membership_telegram", "membership_telegram.json", pkg.DateRange{}, pkg.DateOrderAuto},
+	// localized system messages and media placeholders
+	{"locale_bg", "locale_bg.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"locale_de", "locale_de.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"locale_es", "locale_es.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+	{"locale_pt", "locale_pt.txt", pkg.DateRange{}, pkg.DateOrderAuto},
+}
+
+// golden is what gets compared for every fixture. Chats that fail to parse
+// or prepare record the error instead.
+type golden struct {
+	Statistics *pkg.Stats      `json:"statistics,omitempty"`
+	Cards      []pkg.Card      `json:"cards,omitempty"`
+	Comparison *pkg.Comparison `json:"comparison,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func analyse(t *testing.T, name string, dates pkg.DateRange, order pkg.DateOrder) golden {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// attachments may take up to four times the size of the zip, which is
+	// plenty for media but not for a zip bomb
+	size := int64(len(data))
+	exp, err := pkg.ReadExport(name, data, pkg.ExportLimits{Chat: size, Media: 4 * size, Files: 100})
+	if err != nil {
+		return golden{Error: err.Error()}
+	}
+
+	messages, err := pkg.ParseExport(exp, pkg.ParseOptions{Location: time.UTC, DateOrder: order})
+	if err != nil {
+		return golden{Error: err.Error()}
+	}
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := pkg.PrepDBRange(db, messages, dates); err != nil {
+		return golden{Error: err.Error()}
+	}
+
+	stats := pkg.GetStats(db)
+	stats.Attachments.Partial = exp.AttachmentsPartial
+	comparison, err := pkg.GetComparison(db, stats, dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := pkg.AssignCardsRand(db, stats, rand.New(rand.NewSource(goldenSeed)))
+	return golden{Statistics: &stats, Cards: cards, Comparison: comparison}
+}
+
+func TestGolden(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.golden, func(t *testing.T) {
+			got, err := json.MarshalIndent(analyse(t, f.file, f.dates, f.order), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", f.golden+".golden.json")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test ./tests -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s doesn't match %s, run go test ./tests -update and review the diff\ngot:\n%s", f.file, path, got)
+			}
+		})
+	}
+}
+
+// TestDateOrder checks the first timestamp of chats whose dates read both
+// ways, beyond what ends up in their golden files.
+func TestDateOrder(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		order pkg.DateOrder
+		want  time.Time
+	}{
+		{"us_short.txt", pkg.MonthFirst, time.Date(2025, time.March, 4, 9, 15, 2, 0, time.UTC)},
+		{"us_short.txt", pkg.DayFirst, time.Date(2025, time.April, 3, 9, 15, 2, 0, time.UTC)},
+		{"uk_short.txt", pkg.DateOrderAuto, time.Date(2024, time.April, 3, 9, 15, 0, 0, time.UTC)},
+		{"year_first.txt", pkg.DateOrderAuto, time.Date(2024, time.January, 5, 10, 0, 0, 0, time.UTC)},
+		{"year_first_slashed.txt", pkg.DateOrderAuto, time.Date(2024, time.January, 5, 10, 0, 0, 0, time.UTC)},
+	} {
+		data, err := os.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages, err := pkg.ParseExport(pkg.Export{Ext: filepath.Ext(tc.file), Text: string(data)}, pkg.ParseOptions{Location: time.UTC, DateOrder: tc.order})
+		if err != nil {
+			t.Fatalf("%s as %q: %v", tc.file, tc.order, err)
+		}
+		if got := messages[0].Timestamp; !got.Equal(tc.want) {
+			t.Errorf("%s as %q starts at %s, want %s", tc.file, tc.order, got, tc.want)
+		}
+	}
+}